@@ -0,0 +1,87 @@
+package fugl
+
+import (
+	"errors"
+)
+
+/* Signature backends
+ *
+ * A signer produces a proof containing the signed message,
+ * a verifier checks the signatures on a proof and recovers the message.
+ */
+
+const (
+	BackendPGP     = "pgp"
+	BackendEd25519 = "ed25519"
+	BackendSSH     = "ssh"
+)
+
+type Signer interface {
+	Sign(message []byte) (string, error)
+}
+
+// signers adding their signatures to an existing proof (e.g. officers signing separately)
+type Cosigner interface {
+	// returns the proof with the signatures of the signer added, keeping existing signatures
+	Cosign(proof []byte) (string, error)
+}
+
+type Verifier interface {
+	// returns the signed message and the fingerprints of the signers
+	Verify(proof []byte) ([]byte, []string, error)
+
+	// returns a verifier with the retired key replaced by the next key
+	Rotate(rotation *KeyRotation) (Verifier, error)
+
+	// returns the armored public keys (for distribution)
+	PublicKeys() (string, error)
+}
+
+/* Adds the signatures of the signer to the proof,
+ * the existing signatures are kept (but not verified)
+ */
+
+func CosignProof(signer Signer, proof string) (string, error) {
+	cosigner, ok := signer.(Cosigner)
+	if !ok {
+		return "", errors.New("Signer does not support adding signatures to a proof")
+	}
+	return cosigner.Cosign([]byte(proof))
+}
+
+/* Loads a verifier for the backend from (concatenated) public key files,
+ * requiring threshold signatures (0 is treated as 1)
+ */
+
+func LoadVerifier(backend string, keys []byte, threshold int) (Verifier, error) {
+	switch backend {
+	case BackendPGP, "":
+		keyring, err := PGPLoadKeyring(keys)
+		if err != nil {
+			return nil, err
+		}
+		if threshold < 0 || threshold > len(keyring) {
+			return nil, errors.New("Invalid signature threshold")
+		}
+		return PGPVerifier{Keyring: keyring, Threshold: threshold}, nil
+	case BackendEd25519:
+		keyring, err := Ed25519LoadKeyring(keys)
+		if err != nil {
+			return nil, err
+		}
+		if threshold < 0 || threshold > len(keyring) {
+			return nil, errors.New("Invalid signature threshold")
+		}
+		return Ed25519Verifier{Keys: keyring, Threshold: threshold}, nil
+	case BackendSSH:
+		signers, err := SSHLoadAllowedSigners(keys)
+		if err != nil {
+			return nil, err
+		}
+		if threshold < 0 || threshold > len(signers) {
+			return nil, errors.New("Invalid signature threshold")
+		}
+		return SSHVerifier{Signers: signers, Threshold: threshold}, nil
+	}
+	return nil, errors.New("Unsupported signature backend: " + backend)
+}
@@ -1,11 +1,7 @@
 package fugl
 
 import (
-	"errors"
 	"fmt"
-	"io/ioutil"
-	"path"
-	"strings"
 	"time"
 )
 
@@ -13,7 +9,8 @@ import (
  */
 
 const (
-	CanaryVersion       = 0
+	CanaryVersion       = 1 // version of new canaries
+	CanaryVersionMin    = 0 // oldest version still accepted
 	CanaryTimeFormat    = time.RFC3339
 	ProofFileTimeFormat = "20060102150405" // must be a valid filename and sortable
 	CanaryNonceSize     = 32
@@ -21,76 +18,117 @@ const (
 	ProofFileName       = "proof-%s-%s" + ProofFileExtension
 )
 
-func CheckCanary(new *Canary, old *Canary, now time.Time) error {
+func CheckCanary(new *Canary, old *Canary, oldProof string, now time.Time) error {
 	err := CheckCanaryFormat(new, now)
 	if err != nil {
 		return err
 	}
-	return CheckCanaryPrevious(new, old)
+	return CheckCanaryPrevious(new, old, oldProof)
 }
 
 func CheckCanaryFormat(canary *Canary, now time.Time) error {
-	if canary.Version != CanaryVersion {
-		return errors.New("Unsupported canary version")
+	return canary.Validate(now).Err()
+}
+
+/* Returns every rule on the fields of the canary which is violated (see CheckCanaryFormat)
+ */
+
+func (c *Canary) Validate(now time.Time) ValidationErrors {
+	return validateFormat(c, now, 0)
+}
+
+// skew is the clock skew allowed between the signer and the verifier
+func validateFormat(canary *Canary, now time.Time, skew time.Duration) ValidationErrors {
+	var errs ValidationErrors
+	if !CanaryVersionSupported(canary.Version) {
+		errs = append(errs, mismatchError(ErrCodeUnsupportedVersion, "version",
+			fmt.Sprintf("%d-%d", CanaryVersionMin, CanaryVersion), fmt.Sprint(canary.Version),
+			"Unsupported canary version"))
 	}
 	if len(canary.Nonce) != CanaryNonceSize {
-		return errors.New(fmt.Sprintf("Nonce must be %d characters long", CanaryNonceSize))
+		errs = append(errs, mismatchError(ErrCodeInvalidNonce, "nonce",
+			fmt.Sprint(CanaryNonceSize), fmt.Sprint(len(canary.Nonce)),
+			fmt.Sprintf("Nonce must be %d characters long", CanaryNonceSize)))
 	}
-	if now.After(canary.Expiry.Time()) {
-		return errors.New("Canary has expired")
+	if now.Add(-skew).After(canary.Expiry.Time()) {
+		errs = append(errs, mismatchError(ErrCodeExpired, "expiry",
+			"after "+now.Add(-skew).Format(CanaryTimeFormat), canary.Expiry.String(),
+			"Canary has expired"))
 	}
 	if canary.Author == "" {
-		return errors.New("Author field is empty")
+		errs = append(errs, validationError(ErrCodeMissingAuthor, "author", "Author field is empty"))
 	}
-	if canary.Creation.Time().After(now) {
-		return errors.New("Creation time cannot be in the future (canary not valid yet)")
+	if canary.Creation.Time().After(now.Add(skew)) {
+		errs = append(errs, mismatchError(ErrCodeNotYetValid, "creation",
+			"before "+now.Add(skew).Format(CanaryTimeFormat), canary.Creation.String(),
+			"Creation time cannot be in the future (canary not valid yet)"))
 	}
-	return nil
-}
-
-func CheckCanaryPrevious(new *Canary, old *Canary) error {
-	if old == nil {
-		return nil
-	}
-	if old.Final {
-		return errors.New("Current canary is final")
+	// version 0 promises are bare strings, which were never required to be unique or non-empty
+	if canary.Version >= 1 {
+		errs = append(errs, validatePromises(canary.Promises)...)
 	}
-	if old.Creation.Time().After(new.Creation.Time()) {
-		return errors.New("Current canary has creation after new")
+	if canary.Rotation != nil {
+		if err := canary.Rotation.check(); err != nil {
+			errs = append(errs, validationError(ErrCodeInvalidRotation, "rotation", err.Error()))
+		}
 	}
-	if !new.Expiry.Time().After(old.Expiry.Time()) {
-		return errors.New("New canary does not have expiry time after old")
+	if err := checkFreshnessFormat(canary.Freshness); err != nil {
+		errs = append(errs, validationError(ErrCodeInvalidFreshness, "freshness", err.Error()))
 	}
-	return nil
+	return errs
 }
 
-func LoadLatestProof(dir string) (string, error) {
-	// find newest proof
-	var proofFile string
-	files, _ := ioutil.ReadDir(dir)
-	for _, file := range files {
-		// check if proof file
-		if file.IsDir() {
-			return "", errors.New("Directory found in store")
+func validatePromises(promises []Promise) ValidationErrors {
+	var errs ValidationErrors
+	ids := make(map[string]bool)
+	for _, promise := range promises {
+		if promise.ID == "" || promise.Text == "" {
+			errs = append(errs, validationError(ErrCodeInvalidPromise, "promises", "Promise must have an identifier and text"))
+			continue
 		}
-		if !strings.HasSuffix(file.Name(), ProofFileExtension) {
-			return "", errors.New("Non-proof file in store: " + file.Name())
+		if ids[promise.ID] {
+			errs = append(errs, mismatchError(ErrCodeDuplicatePromise, "promises", "", promise.ID,
+				"Duplicate promise identifier: "+promise.ID))
 		}
-		proofFile = file.Name()
+		ids[promise.ID] = true
 	}
+	return errs
+}
 
-	// read proof
-	if proofFile != "" {
-		proof, err := ioutil.ReadFile(path.Join(dir, proofFile))
-		return string(proof), err
-	}
-	return "", nil
+/* checks that the new canary can supersede the old,
+ * where oldProof is the proof from which old was opened
+ */
+
+func CheckCanaryPrevious(new *Canary, old *Canary, oldProof string) error {
+	return new.ValidatePrevious(old, oldProof).Err()
 }
 
-func SaveToDirectory(proof string, dir string, when time.Time) error {
-	hash := HashString(proof)
-	date := time.Time(when).Format(ProofFileTimeFormat)
-	fileName := fmt.Sprintf(ProofFileName, date, hash)
-	filePath := path.Join(dir, fileName)
-	return ioutil.WriteFile(filePath, []byte(proof), 0600)
+/* Returns every rule on the link to the previous canary which is violated (see CheckCanaryPrevious)
+ */
+
+func (c *Canary) ValidatePrevious(old *Canary, oldProof string) ValidationErrors {
+	var errs ValidationErrors
+	if old == nil {
+		if c.Previous != "" {
+			errs = append(errs, mismatchError(ErrCodeUnknownPrevious, "previous", "", c.Previous,
+				"Canary links to unknown previous proof"))
+		}
+		return errs
+	}
+	if c.Previous != HashString(oldProof) {
+		errs = append(errs, mismatchError(ErrCodeBrokenLink, "previous", HashString(oldProof), c.Previous,
+			"Canary does not link to current proof"))
+	}
+	if old.Final {
+		errs = append(errs, validationError(ErrCodeFinal, "previous", "Current canary is final"))
+	}
+	if old.Creation.Time().After(c.Creation.Time()) {
+		errs = append(errs, mismatchError(ErrCodeCreationOrder, "creation", "after "+old.Creation.String(), c.Creation.String(),
+			"Current canary has creation after new"))
+	}
+	if !c.Expiry.Time().After(old.Expiry.Time()) {
+		errs = append(errs, mismatchError(ErrCodeExpiryOrder, "expiry", "after "+old.Expiry.String(), c.Expiry.String(),
+			"New canary does not have expiry time after old"))
+	}
+	return errs
 }
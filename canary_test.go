@@ -0,0 +1,38 @@
+package fugl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCanary__CheckPreviousLink(t *testing.T) {
+	now := time.Now()
+	oldProof := "old proof"
+	old := Canary{
+		Creation: CanaryTime(now.Add(-time.Hour)),
+		Expiry:   CanaryTime(now.Add(time.Hour)),
+	}
+	new := Canary{
+		Creation: CanaryTime(now),
+		Expiry:   CanaryTime(now.Add(2 * time.Hour)),
+		Previous: HashString(oldProof),
+	}
+
+	if err := CheckCanaryPrevious(&new, &old, oldProof); err != nil {
+		t.Fatalf("error checking linked canary, err=%v", err)
+	}
+	if err := CheckCanaryPrevious(&new, &old, "replaced proof"); err == nil {
+		t.Fatal("expected an error when previous proof does not match link")
+	}
+	if err := CheckCanaryPrevious(&new, nil, ""); err == nil {
+		t.Fatal("expected an error when linking to a missing proof")
+	}
+
+	new.Previous = ""
+	if err := CheckCanaryPrevious(&new, nil, ""); err != nil {
+		t.Fatalf("error checking first canary, err=%v", err)
+	}
+	if err := CheckCanaryPrevious(&new, &old, oldProof); err == nil {
+		t.Fatal("expected an error when link is missing")
+	}
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/fatih/color"
 	"github.com/rot256/fugl"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -13,8 +15,19 @@ const tagFlags = "flag"
 
 type Flags struct {
 	Proof       string        // path to proof
-	PublicKey   string        // path to pgp public key
-	PrivateKey  string        // path to pgp private key
+	Previous    string        // path to previous proof
+	Backend     string        // signature backend
+	PublicKey   string        // path to public key(s)
+	PrivateKey  string        // path to private key(s)
+	SignCommand string        // external command producing the proof
+	Threshold   int           // number of signatures required
+	Strict      bool          // require canonical layout of proofs
+	Policy      string        // path to validation policy
+	Freshness   anchorsFlag   // freshness anchors (embedded or trusted)
+	Timestamp   string        // path to timestamp token over proof
+	TSACerts    string        // path to trusted timestamp authority certificates
+	NextKey     string        // path to public key replacing a signer key
+	RetireKey   string        // fingerprint of signer key being replaced
 	Author      string        // creator of canary
 	Description string        // file containing canary description
 	Expire      time.Duration // expiration delta
@@ -28,8 +41,10 @@ type Flags struct {
 }
 
 const (
+	FlagNameBackend    = "backend"
 	FlagNamePublicKey  = "public-key"
 	FlagNamePrivateKey = "private-key"
+	FlagNameSignCmd    = "sign-command"
 	FlagNameProxy      = "proxy"
 	FlagNameAddress    = "address"
 	FlagNameOperation  = "operation"
@@ -38,12 +53,43 @@ const (
 	FlagNameJson       = "json"
 	FlagNameManifest   = "manifest"
 	FlagNameProof      = "proof"
+	FlagNamePrevious   = "previous"
+	FlagNameThreshold  = "threshold"
+	FlagNameStrict     = "strict"
+	FlagNamePolicy     = "policy"
+	FlagNameFreshness  = "freshness"
+	FlagNameTimestamp  = "timestamp"
+	FlagNameTSACerts   = "tsa-certs"
+	FlagNameNextKey    = "next-key"
+	FlagNameRetireKey  = "retire-key"
 )
 
 func init() {
 	flag.Usage = printHelp
 }
 
+/* Freshness anchors are supplied by repeating the flag
+ */
+
+type anchorsFlag []fugl.FreshnessAnchor
+
+func (a *anchorsFlag) String() string {
+	var anchors []string
+	for _, anchor := range *a {
+		anchors = append(anchors, anchor.Source+"="+anchor.Value)
+	}
+	return strings.Join(anchors, ", ")
+}
+
+func (a *anchorsFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return errors.New("freshness anchor must be of the form 'source=value'")
+	}
+	*a = append(*a, fugl.FreshnessAnchor{Source: parts[0], Value: parts[1]})
+	return nil
+}
+
 type FlagOpt struct {
 	required map[string]bool
 	optional map[string]bool
@@ -109,8 +155,19 @@ func parseFlags() Flags {
 	var flags Flags
 	flag.StringVar(&flags.Manifest, FlagNameManifest, "./manifest.toml", "canary manifest, for creating new canaries")
 	flag.StringVar(&flags.Proof, FlagNameProof, "./temp"+fugl.ProofFileExtension, "path to proof")
-	flag.StringVar(&flags.PrivateKey, FlagNamePrivateKey, "", "path to a PGP private key")
-	flag.StringVar(&flags.PublicKey, FlagNamePublicKey, "", "path to a PGP public key")
+	flag.StringVar(&flags.Previous, FlagNamePrevious, "", "path to previous proof (linked to by new canaries)")
+	flag.StringVar(&flags.Backend, FlagNameBackend, fugl.BackendPGP, "signature backend, supported: pgp, ed25519, ssh")
+	flag.StringVar(&flags.PrivateKey, FlagNamePrivateKey, "", "path to a private key (comma separated for multiple signers)")
+	flag.StringVar(&flags.SignCommand, FlagNameSignCmd, "", "command signing canaries (e.g. 'gpg --clearsign --local-user X'), instead of a private key")
+	flag.StringVar(&flags.PublicKey, FlagNamePublicKey, "", "path to a public key (comma separated for multiple signers)")
+	flag.IntVar(&flags.Threshold, FlagNameThreshold, 1, "number of valid signatures required")
+	flag.BoolVar(&flags.Strict, FlagNameStrict, false, "reject proofs not in the canonical layout")
+	flag.StringVar(&flags.Policy, FlagNamePolicy, "", "path to validation policy (TOML), applied when creating and verifying")
+	flag.Var(&flags.Freshness, FlagNameFreshness, "freshness anchor 'source=value', embedded when creating and trusted when verifying (repeatable)")
+	flag.StringVar(&flags.NextKey, FlagNameNextKey, "", "path to a public key, announced as replacing a signer key")
+	flag.StringVar(&flags.RetireKey, FlagNameRetireKey, "", "fingerprint of the signer key being replaced (default: the private key)")
+	flag.StringVar(&flags.Timestamp, FlagNameTimestamp, "", "path to RFC 3161 timestamp token over the proof (default: proof path + "+fugl.TimestampFileExtension+")")
+	flag.StringVar(&flags.TSACerts, FlagNameTSACerts, "", "path to trusted timestamp authority certificates (PEM), verifies the timestamp of the proof")
 	flag.StringVar(&flags.Proxy, FlagNameProxy, "", "socks5 proxy")
 	flag.StringVar(&flags.Address, FlagNameAddress, "", "address of canary server")
 	flag.StringVar(&flags.Operation, FlagNameOperation, "", "operation, supported: pull, push, verify")
@@ -135,12 +192,14 @@ func printHelp() {
 	msg := `Help:
 1. Getting started
   This is a client for the fugl canary system.
-  To use this client you must specify 1 of three operations:
+  To use this client you must specify one of the operations:
 
     push   : uploads a new canary to a server
     pull   : downloads the latest canary from the remote
     verify : verifies a locally stored canary
     create : creates a new canary locally
+    keygen : creates a new key pair (ed25519 backend only)
+    cosign : adds signatures to a locally stored canary
 
   Using --operation=[action]
   You may specify any one of these to see what arguments they require.
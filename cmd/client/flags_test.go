@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFlags__Freshness(t *testing.T) {
+	var anchors anchorsFlag
+	if err := anchors.Set("bitcoin-block=00000000000000000002a7c4"); err != nil {
+		t.Fatalf("error parsing freshness anchor, err=%v", err)
+	}
+	if err := anchors.Set("headline=Local bird sings: a=b"); err != nil {
+		t.Fatalf("error parsing freshness anchor, err=%v", err)
+	}
+	if len(anchors) != 2 || anchors[1].Source != "headline" || anchors[1].Value != "Local bird sings: a=b" {
+		t.Fatalf("unexpected freshness anchors: %v", anchors)
+	}
+	for _, invalid := range []string{"headline", "=value", "source="} {
+		if err := anchors.Set(invalid); err == nil {
+			t.Fatalf("expected an error parsing freshness anchor %q", invalid)
+		}
+	}
+}
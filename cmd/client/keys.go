@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"github.com/rot256/fugl"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+/* Key flags may contain a comma separated list of paths,
+ * used for canaries requiring multiple signatures.
+ * Public key files may be keyrings containing multiple keys.
+ */
+
+func splitKeyPaths(paths string) []string {
+	var out []string
+	for _, path := range strings.Split(paths, ",") {
+		path = strings.TrimSpace(path)
+		if path != "" {
+			out = append(out, path)
+		}
+	}
+	return out
+}
+
+func loadPGPPrivateKey(path string) (*openpgp.Entity, error) {
+	skData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sk, err := fugl.PGPLoadPrivateKey(skData)
+	if err != nil {
+		return nil, err
+	}
+	if sk.PrivateKey.Encrypted {
+		fmt.Println("Private key", path, "encrypted, please enter passphrase:")
+		passwd, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		if err != nil {
+			return nil, err
+		}
+		err = sk.PrivateKey.Decrypt(passwd)
+		if err != nil {
+			return nil, errors.New("Failed to decrypt key")
+		}
+	}
+	return sk, err
+}
+
+func loadSSHPrivateKey(path string) (ssh.Signer, error) {
+	skData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sk, err := fugl.SSHLoadPrivateKey(skData, nil)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		fmt.Println("Private key", path, "encrypted, please enter passphrase:")
+		passwd, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		if err != nil {
+			return nil, err
+		}
+		return fugl.SSHLoadPrivateKey(skData, passwd)
+	}
+	return sk, err
+}
+
+func loadEd25519PrivateKey(path string) (ed25519.PrivateKey, error) {
+	skData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sk, err := fugl.Ed25519LoadPrivateKey(skData, nil)
+	if err == fugl.ErrEd25519PassphraseMissing {
+		fmt.Println("Private key", path, "encrypted, please enter passphrase:")
+		passwd, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		if err != nil {
+			return nil, err
+		}
+		return fugl.Ed25519LoadPrivateKey(skData, passwd)
+	}
+	return sk, err
+}
+
+func loadSigner(flags Flags) (fugl.Signer, error) {
+	switch flags.Backend {
+	case fugl.BackendPGP:
+		var signer fugl.PGPSigner
+		for _, path := range splitKeyPaths(flags.PrivateKey) {
+			sk, err := loadPGPPrivateKey(path)
+			if err != nil {
+				return nil, err
+			}
+			signer.Keys = append(signer.Keys, sk)
+		}
+		return signer, nil
+	case fugl.BackendEd25519:
+		var signer fugl.Ed25519Signer
+		for _, path := range splitKeyPaths(flags.PrivateKey) {
+			sk, err := loadEd25519PrivateKey(path)
+			if err != nil {
+				return nil, err
+			}
+			signer.Keys = append(signer.Keys, sk)
+		}
+		return signer, nil
+	case fugl.BackendSSH:
+		var signer fugl.SSHSigner
+		for _, path := range splitKeyPaths(flags.PrivateKey) {
+			sk, err := loadSSHPrivateKey(path)
+			if err != nil {
+				return nil, err
+			}
+			signer.Keys = append(signer.Keys, sk)
+		}
+		return signer, nil
+	}
+	return nil, errors.New("Unsupported signature backend: " + flags.Backend)
+}
+
+func loadVerifier(flags Flags) (fugl.Verifier, error) {
+	var keys []byte
+	for _, path := range splitKeyPaths(flags.PublicKey) {
+		pkData, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, pkData...)
+		keys = append(keys, '\n')
+	}
+	return fugl.LoadVerifier(flags.Backend, keys, flags.Threshold)
+}
+
+/* Creates an announcement replacing one of the signer keys by the next key
+ */
+
+func retiredSigner(flags Flags, fingerprints []string) (int, error) {
+	if flags.RetireKey == "" {
+		if len(fingerprints) != 1 {
+			return 0, errors.New("multiple signers, specify the key to retire")
+		}
+		return 0, nil
+	}
+	for i, fingerprint := range fingerprints {
+		if strings.EqualFold(fingerprint, flags.RetireKey) {
+			return i, nil
+		}
+	}
+	return 0, errors.New("key to retire must be a signer")
+}
+
+func createRotation(flags Flags, signer fugl.Signer) (*fugl.KeyRotation, error) {
+	nextData, err := ioutil.ReadFile(flags.NextKey)
+	if err != nil {
+		return nil, err
+	}
+	var fingerprints []string
+	switch s := signer.(type) {
+	case fugl.PGPSigner:
+		next, err := fugl.PGPLoadPublicKey(nextData)
+		if err != nil {
+			return nil, err
+		}
+		for _, sk := range s.Keys {
+			fingerprints = append(fingerprints, fugl.PGPFingerprint(sk))
+		}
+		i, err := retiredSigner(flags, fingerprints)
+		if err != nil {
+			return nil, err
+		}
+		return fugl.PGPKeyRotation(s.Keys[i], next)
+	case fugl.Ed25519Signer:
+		next, err := fugl.Ed25519LoadPublicKey(nextData)
+		if err != nil {
+			return nil, err
+		}
+		for _, sk := range s.Keys {
+			fingerprints = append(fingerprints, fugl.Ed25519Fingerprint(sk.Public().(ed25519.PublicKey)))
+		}
+		i, err := retiredSigner(flags, fingerprints)
+		if err != nil {
+			return nil, err
+		}
+		return fugl.Ed25519KeyRotation(s.Keys[i].Public().(ed25519.PublicKey), next), nil
+	case fugl.SSHSigner:
+		next, _, _, _, err := ssh.ParseAuthorizedKey(nextData)
+		if err != nil {
+			return nil, err
+		}
+		for _, sk := range s.Keys {
+			fingerprints = append(fingerprints, fugl.SSHFingerprint(sk.PublicKey()))
+		}
+		i, err := retiredSigner(flags, fingerprints)
+		if err != nil {
+			return nil, err
+		}
+		return fugl.SSHKeyRotation(s.Keys[i].PublicKey(), next), nil
+	}
+	return nil, errors.New("Key rotation not supported by backend: " + flags.Backend)
+}
@@ -26,6 +26,10 @@ func main() {
 		operationPush(flags)
 	case "pull":
 		operationPull(flags)
+	case "keygen":
+		operationKeygen(flags)
+	case "cosign":
+		operationCosign(flags)
 	case "":
 		printHelp()
 	default:
@@ -2,18 +2,45 @@ package main
 
 import (
 	"github.com/BurntSushi/toml"
+	"github.com/rot256/fugl"
+	"time"
 )
 
+type ManifestPromise struct {
+	ID       string    `toml:"id"`       // stable identifier of promise
+	Text     string    `toml:"text"`     // the promise itself
+	Category string    `toml:"category"` // optional category
+	Since    time.Time `toml:"since"`    // optional date the promise was first made
+}
+
 type Manifest struct {
-	Author      string   `toml:"author"`      // supposed author of canary
-	Delta       int64    `toml:"delta"`       // time in seconds
-	Promises    []string `toml:"promises"`    // list of promises (for machines)
-	Description string   `toml:"description"` // content of human readable portion
-	Final       bool     `toml:"final"`       // canary is final
+	Version     int64             `toml:"version"`     // canary version (defaults to latest)
+	Author      string            `toml:"author"`      // supposed author of canary
+	Delta       int64             `toml:"delta"`       // time in seconds
+	Promises    []ManifestPromise `toml:"promises"`    // list of promises (for machines)
+	Description string            `toml:"description"` // content of human readable portion
+	Final       bool              `toml:"final"`       // canary is final
 }
 
 func ParseManifest(path string) (Manifest, error) {
-	var manifest Manifest
+	manifest := Manifest{Version: fugl.CanaryVersion}
 	_, err := toml.DecodeFile(path, &manifest)
 	return manifest, err
 }
+
+func (m Manifest) CanaryPromises() []fugl.Promise {
+	var promises []fugl.Promise
+	for _, p := range m.Promises {
+		promise := fugl.Promise{
+			ID:       p.ID,
+			Text:     p.Text,
+			Category: p.Category,
+		}
+		if !p.Since.IsZero() {
+			since := fugl.CanaryTime(p.Since)
+			promise.Since = &since
+		}
+		promises = append(promises, promise)
+	}
+	return promises
+}
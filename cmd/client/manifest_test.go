@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestManifest__Example(t *testing.T) {
+	manifest, err := ParseManifest("manifest.toml")
+	if err != nil {
+		t.Fatalf("error parsing example manifest, err=%v", err)
+	}
+
+	promises := manifest.CanaryPromises()
+	if len(promises) != len(manifest.Promises) {
+		t.Fatalf("expected %d promises, got %d", len(manifest.Promises), len(promises))
+	}
+	for _, promise := range promises {
+		if promise.ID == "" || promise.Text == "" {
+			t.Fatalf("promise missing id or text: %v", promise)
+		}
+	}
+	if promises[0].Since == nil {
+		t.Fatal("since date of first promise not loaded")
+	}
+	if promises[1].Since != nil {
+		t.Fatal("since date set for promise without one")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"github.com/rot256/fugl"
+	"io/ioutil"
+)
+
+/* Adds signatures to an existing proof,
+ * allowing officers to sign separately (e.g. on different machines) until the threshold is met.
+ * The existing signatures are verified before the proof is saved.
+ */
+
+func requiredFlagsCosign(flags Flags) {
+	var opt FlagOpt
+	opt.Required(FlagNamePrivateKey, flags.PrivateKey != "")
+	opt.Required(FlagNamePublicKey, flags.PublicKey != "")
+	opt.Required(FlagNameProof, flags.Proof != "")
+	opt.Optional(FlagNameThreshold, flags.Threshold != 1)
+	opt.Check()
+}
+
+func operationCosign(flags Flags) {
+	requiredFlagsCosign(flags)
+
+	// load proof signed by other officers
+	proof, err := ioutil.ReadFile(flags.Proof)
+	if err != nil {
+		exitError(EXIT_FILE_READ_ERROR, "Failed to read proof: %s", err.Error())
+	}
+	signer, err := loadSigner(flags)
+	if err != nil {
+		exitError(EXIT_FILE_READ_ERROR, "Failed to read private key: %s", err.Error())
+	}
+
+	// add signatures, every signature must verify (the threshold may not yet be met)
+	threshold := flags.Threshold
+	flags.Threshold = 1
+	verifier, err := loadVerifier(flags)
+	if err != nil {
+		exitError(EXIT_FILE_READ_ERROR, "Failed to load public key: %s", err.Error())
+	}
+	if _, err := fugl.VerifyProof(verifier, string(proof)); err != nil {
+		exitError(EXIT_INVALID_SIGNATURE, "Failed to validate signatures on proof: %s", err.Error())
+	}
+	cosigned, err := fugl.CosignProof(signer, string(proof))
+	if err != nil {
+		exitError(EXIT_INVALID_SIGNATURE, "Failed to sign proof: %s", err.Error())
+	}
+	opened, err := fugl.VerifyProof(verifier, cosigned)
+	if err != nil {
+		exitError(EXIT_INVALID_SIGNATURE, "Failed to validate signatures on signed proof: %s", err.Error())
+	}
+
+	// write to output
+	err = ioutil.WriteFile(flags.Proof, []byte(cosigned), 0644)
+	if err != nil {
+		exitError(EXIT_FILE_WRITE_ERROR, "Failed to write proof to file: %s", err.Error())
+	}
+	fmt.Println("Saved signed proof to:", flags.Proof)
+	for _, signer := range opened.Signers {
+		fmt.Println("Signed by:", signer)
+	}
+	fmt.Println("Author:", opened.Canary.Author)
+	fmt.Println("Expires:", opened.Canary.Expiry.String())
+	if len(opened.Signers) < threshold {
+		fmt.Printf("Signed by %d keys, %d required\n", len(opened.Signers), threshold)
+	}
+}
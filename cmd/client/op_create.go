@@ -1,21 +1,30 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"github.com/rot256/fugl"
-	"golang.org/x/crypto/openpgp"
-	"golang.org/x/crypto/ssh/terminal"
 	"io/ioutil"
 	"os"
+	"strings"
 	"time"
 )
 
 func requiredFlagsCreate(flags Flags) {
 	var opt FlagOpt
-	opt.Required(FlagNamePrivateKey, flags.PrivateKey != "")
+	if flags.SignCommand == "" {
+		opt.Required(FlagNamePrivateKey, flags.PrivateKey != "")
+	} else {
+		// output of signing command is verified before use
+		opt.Required(FlagNameSignCmd, true)
+		opt.Required(FlagNamePublicKey, flags.PublicKey != "")
+	}
 	opt.Required(FlagNameManifest, flags.Manifest != "")
 	opt.Required(FlagNameProof, flags.Proof != "")
+	opt.Optional(FlagNamePrevious, flags.Previous != "")
+	opt.Optional(FlagNameNextKey, flags.NextKey != "")
+	opt.Optional(FlagNameRetireKey, flags.RetireKey != "")
+	opt.Optional(FlagNameFreshness, len(flags.Freshness) > 0)
+	opt.Optional(FlagNamePolicy, flags.Policy != "")
 	opt.Check()
 }
 
@@ -29,53 +38,92 @@ func operationCreate(flags Flags) {
 		exitError(EXIT_FILE_READ_ERROR, "Failed to load manifest %s", err.Error())
 	}
 
-	// load private key
-	sk, err := func() (*openpgp.Entity, error) {
-		skData, err := ioutil.ReadFile(flags.PrivateKey)
+	// load validation policy
+	policy, err := LoadPolicy(flags.Policy)
+	if err != nil {
+		exitError(EXIT_FILE_READ_ERROR, "Failed to load policy: %s", err.Error())
+	}
+
+	// load private keys (or signing command)
+	var signer fugl.Signer
+	if flags.SignCommand != "" {
+		signer, err = fugl.NewCommandSigner(flags.SignCommand)
+	} else {
+		signer, err = loadSigner(flags)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read private key: %s", err.Error())
+		os.Exit(EXIT_FILE_READ_ERROR)
+	}
+
+	// link to previous proof
+	var previous string
+	if flags.Previous != "" {
+		prev, err := ioutil.ReadFile(flags.Previous)
 		if err != nil {
-			return nil, err
+			exitError(EXIT_FILE_READ_ERROR, "Failed to read previous proof: %s", err.Error())
 		}
-		sk, err := fugl.PGPLoadPrivateKey(skData)
+		previous = fugl.HashString(string(prev))
+	}
+
+	// announce key rotation
+	var rotation *fugl.KeyRotation
+	if flags.NextKey != "" {
+		rotation, err = createRotation(flags, signer)
 		if err != nil {
-			return nil, err
+			exitError(EXIT_INVALID_ARGUMENTS, "Failed to create key rotation: %s", err.Error())
 		}
-		if sk.PrivateKey.Encrypted {
-			fmt.Println("Private key encrypted, please enter passphrase:")
-			passwd, err := terminal.ReadPassword(int(os.Stdin.Fd()))
-			if err != nil {
-				return nil, err
-			}
-			err = sk.PrivateKey.Decrypt(passwd)
-			if err != nil {
-				return nil, errors.New("Failed to decrypt key")
-			}
-		}
-		return sk, err
-	}()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to read private key: %s", err.Error())
-		os.Exit(EXIT_FILE_READ_ERROR)
 	}
 
-	// create canary
-	now := time.Now()
+	// create canary (times are serialized in seconds, the policy is applied to the serialized times)
+	now := time.Now().Truncate(time.Second)
 	expire := now.Add(time.Duration(manifest.Delta) * time.Second)
 	canary := fugl.Canary{
-		Version:  fugl.CanaryVersion,
+		Version:  manifest.Version,
 		Author:   manifest.Author,
 		Creation: fugl.CanaryTime(now),
 		Expiry:   fugl.CanaryTime(expire),
+		Promises: manifest.CanaryPromises(),
 		Nonce:    fugl.GetRandStr(fugl.CanaryNonceSize),
 		Final:    manifest.Final,
+		Previous: previous,
+		Rotation: rotation,
+	}
+	if len(flags.Freshness) > 0 {
+		canary.Freshness = []fugl.FreshnessAnchor(flags.Freshness)
+	}
+
+	// apply policy before signing
+	err = policy.CheckFormat(&canary, now)
+	if err != nil {
+		exitError(EXIT_INVALID_CANARY, "Canary violates policy: %s", err.Error())
 	}
 
 	// sign canary, producing proof
-	proof, err := fugl.SealProof(sk, canary, manifest.Description)
+	proof, err := fugl.SealProof(signer, canary, manifest.Description)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to sign canary: %s", err.Error())
 		os.Exit(EXIT_FILE_READ_ERROR)
 	}
 
+	// validate output of signing command
+	if flags.SignCommand != "" {
+		verifier, err := loadVerifier(flags)
+		if err != nil {
+			exitError(EXIT_FILE_READ_ERROR, "Failed to load public key: %s", err.Error())
+		}
+		signed, err := fugl.VerifyProofStrict(verifier, proof)
+		if err != nil {
+			exitError(EXIT_INVALID_SIGNATURE, "Signing command produced an invalid proof: %s", err.Error())
+		}
+		if !signed.Canary.Equal(canary) {
+			exitError(EXIT_INVALID_CANARY, "Signing command produced a proof for a different canary")
+		}
+		if signed.Description != strings.TrimRight(manifest.Description, "\n") {
+			exitError(EXIT_INVALID_CANARY, "Signing command produced a proof with a different description")
+		}
+	}
+
 	// write to output
 	err = ioutil.WriteFile(flags.Proof, []byte(proof), 0644)
 	if err != nil {
@@ -85,4 +133,7 @@ func operationCreate(flags Flags) {
 	if manifest.Final {
 		fmt.Println("WARNING: This canary is final!")
 	}
+	if rotation != nil {
+		fmt.Println("WARNING: This canary retires key:", rotation.Retire)
+	}
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/rot256/fugl"
+	"golang.org/x/crypto/ssh/terminal"
+	"io/ioutil"
+	"os"
+)
+
+/* Generates a new key pair for backends without existing tooling,
+ * PGP keys should be created using e.g. gpg
+ */
+
+func requiredFlagsKeygen(flags Flags) {
+	var opt FlagOpt
+	opt.Required(FlagNamePublicKey, flags.PublicKey != "")
+	opt.Required(FlagNamePrivateKey, flags.PrivateKey != "")
+	opt.Check()
+}
+
+func operationKeygen(flags Flags) {
+	requiredFlagsKeygen(flags)
+	if flags.Backend != fugl.BackendEd25519 {
+		exitError(EXIT_INVALID_ARGUMENTS, "Key generation not supported for backend: %s", flags.Backend)
+	}
+
+	passphrase := readNewPassphrase()
+	public, private, err := fugl.Ed25519GenerateKey(passphrase)
+	if err != nil {
+		exitError(EXIT_INVALID_ARGUMENTS, "Failed to generate key: %s", err.Error())
+	}
+	err = ioutil.WriteFile(flags.PrivateKey, []byte(private), 0600)
+	if err != nil {
+		exitError(EXIT_FILE_WRITE_ERROR, "Failed to write private key to file: %s", err.Error())
+	}
+	err = ioutil.WriteFile(flags.PublicKey, []byte(public), 0644)
+	if err != nil {
+		exitError(EXIT_FILE_WRITE_ERROR, "Failed to write public key to file: %s", err.Error())
+	}
+	fmt.Println("Saved new private key to:", flags.PrivateKey)
+	fmt.Println("Saved new public key to:", flags.PublicKey)
+}
+
+// reads the passphrase encrypting the private key (twice)
+func readNewPassphrase() []byte {
+	fmt.Println("Enter passphrase for the private key (empty for no passphrase):")
+	passphrase, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	if err != nil {
+		exitError(EXIT_INVALID_ARGUMENTS, "Failed to read passphrase: %s", err.Error())
+	}
+	fmt.Println("Enter passphrase again:")
+	again, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	if err != nil {
+		exitError(EXIT_INVALID_ARGUMENTS, "Failed to read passphrase: %s", err.Error())
+	}
+	if !bytes.Equal(passphrase, again) {
+		exitError(EXIT_INVALID_ARGUMENTS, "Passphrases do not match")
+	}
+	if len(passphrase) == 0 {
+		fmt.Println("Warning: the private key is stored unencrypted")
+	}
+	return passphrase
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/base64"
 	"fmt"
 	"github.com/rot256/fugl"
 	"io/ioutil"
@@ -61,4 +62,18 @@ func operationPull(flags Flags) {
 		exitError(EXIT_FILE_WRITE_ERROR, "Failed to write proof to file: %s", err.Error())
 	}
 	fmt.Println("Saved to:", flags.Proof)
+
+	// write timestamp token (if any) alongside proof
+	if header := resp.Header.Get(fugl.SERVER_TIMESTAMP_HEADER); header != "" {
+		token, err := base64.StdEncoding.DecodeString(header)
+		if err != nil {
+			exitError(EXIT_CONNECTION_FAILURE, "Failed to decode timestamp: %s", err.Error())
+		}
+		path := flags.Proof + fugl.TimestampFileExtension
+		err = ioutil.WriteFile(path, token, 0644)
+		if err != nil {
+			exitError(EXIT_FILE_WRITE_ERROR, "Failed to write timestamp to file: %s", err.Error())
+		}
+		fmt.Println("Saved timestamp to:", path)
+	}
 }
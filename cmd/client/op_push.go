@@ -1,11 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/rot256/fugl"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
 func requiredFlagsPush(flags Flags) {
@@ -51,7 +53,28 @@ func operationPush(flags Flags) {
 		if err != nil {
 			exitError(EXIT_CONNECTION_FAILURE, "Submission failed: %s", resp.Status)
 		}
+		var rejection fugl.ValidationError
+		if json.Unmarshal(msg, &rejection) == nil && rejection.Code != "" {
+			exitError(EXIT_INVALID_REMOTE_CANARY, "Submission failed %s with: '%s' (%s)", resp.Status, rejection.Message, describeRejection(rejection))
+		}
 		exitError(EXIT_CONNECTION_FAILURE, "Submission failed %s with: '%s'", resp.Status, string(msg))
 	}
 	fmt.Println("Successfully pushed new proof to server")
+	if signers := resp.Header.Get(fugl.SERVER_SIGNERS_HEADER); signers != "" {
+		fmt.Println("Signed by:", signers)
+	}
+}
+
+func describeRejection(rejection fugl.ValidationError) string {
+	details := []string{"code: " + rejection.Code}
+	if rejection.Field != "" {
+		details = append(details, "field: "+rejection.Field)
+	}
+	if rejection.Expected != "" {
+		details = append(details, "expected: "+rejection.Expected)
+	}
+	if rejection.Actual != "" {
+		details = append(details, "actual: "+rejection.Actual)
+	}
+	return strings.Join(details, ", ")
 }
@@ -3,8 +3,8 @@ package main
 import (
 	"fmt"
 	"github.com/rot256/fugl"
-	"golang.org/x/crypto/openpgp"
 	"io/ioutil"
+	"os"
 	"time"
 )
 
@@ -16,6 +16,13 @@ func requiredFlagsVerify(flags Flags) {
 	var opt FlagOpt
 	opt.Required(FlagNamePublicKey, flags.PublicKey != "")
 	opt.Required(FlagNameProof, flags.Proof != "")
+	opt.Optional(FlagNameThreshold, flags.Threshold != 1)
+	opt.Optional(FlagNamePrevious, flags.Previous != "")
+	opt.Optional(FlagNameStrict, flags.Strict)
+	opt.Optional(FlagNamePolicy, flags.Policy != "")
+	opt.Optional(FlagNameFreshness, len(flags.Freshness) > 0)
+	opt.Optional(FlagNameTSACerts, flags.TSACerts != "")
+	opt.Optional(FlagNameTimestamp, flags.Timestamp != "")
 	opt.Check()
 }
 
@@ -28,30 +35,121 @@ func operationVerify(flags Flags) {
 		exitError(EXIT_FILE_READ_ERROR, "Failed to input proof: %s", err.Error())
 	}
 
-	// load public key
-	pk, err := func() (*openpgp.Entity, error) {
-		skData, err := ioutil.ReadFile(flags.PublicKey)
-		if err != nil {
-			return nil, err
-		}
-		return fugl.PGPLoadPublicKey(skData)
-	}()
+	// load validation policy
+	policy, err := LoadPolicy(flags.Policy)
+	if err != nil {
+		exitError(EXIT_FILE_READ_ERROR, "Failed to load policy: %s", err.Error())
+	}
+
+	// load public keys
+	verifier, err := loadVerifier(flags)
 	if err != nil {
 		exitError(EXIT_FILE_READ_ERROR, "Failed to read public key: %s", err.Error())
 	}
 
+	// open previous proof, following announced key rotation
+	var prevCanary *fugl.Canary
+	var prevProof []byte
+	if flags.Previous != "" {
+		prevProof, err = ioutil.ReadFile(flags.Previous)
+		if err != nil {
+			exitError(EXIT_FILE_READ_ERROR, "Failed to read previous proof: %s", err.Error())
+		}
+		prevCanary, _, err = fugl.OpenProof(verifier, string(prevProof))
+		if err != nil {
+			exitError(EXIT_INVALID_SIGNATURE, "Failed to validate signature on previous proof: %s", err.Error())
+		}
+		verifier, err = verifier.Rotate(prevCanary.Rotation)
+		if err != nil {
+			exitError(EXIT_INVALID_CANARY, "Failed to follow key rotation: %s", err.Error())
+		}
+	}
+
 	// validate new proof
-	canary, description, err := fugl.OpenProof(pk, string(proof))
+	verify := fugl.VerifyProof
+	if flags.Strict {
+		verify = fugl.VerifyProofStrict
+	}
+	opened, err := verify(verifier, string(proof))
 	if err != nil {
 		exitError(EXIT_INVALID_SIGNATURE, "Failed to validate signature on proof: %s", err.Error())
 	}
+	canary := opened.Canary
 
-	// verify fields
-	err = fugl.CheckCanaryFormat(canary, time.Now())
-	if err != nil {
-		exitError(EXIT_INVALID_CANARY, "Failed to validate canary fields: %s", err.Error())
+	// verify timestamp over proof
+	if flags.TSACerts != "" {
+		verifyTimestamp(flags, opened, string(proof))
+	}
+
+	// verify fields, freshness against trusted values and link to previous proof
+	violations := policy.Validate(canary, time.Now())
+	if len(flags.Freshness) > 0 {
+		err = fugl.CheckCanaryFreshness(canary, fugl.TrustedFreshness(flags.Freshness))
+		if violation, ok := err.(*fugl.ValidationError); ok {
+			violations = append(violations, violation)
+		} else if err != nil {
+			exitError(EXIT_INVALID_CANARY, "Failed to validate freshness: %s", err.Error())
+		}
+	}
+	if prevCanary != nil {
+		violations = append(violations, policy.ValidatePrevious(canary, prevCanary, string(prevProof))...)
+	}
+	if len(violations) > 0 {
+		printViolations(violations)
+		exitError(EXIT_INVALID_CANARY, "Failed to validate canary: %d rules violated", len(violations))
+	}
+	if prevCanary != nil {
+		for _, change := range fugl.Diff(prevCanary, canary) {
+			fmt.Println("Changed:", change)
+		}
+	}
+	for _, signer := range opened.Signers {
+		fmt.Println("Signed by:", signer)
 	}
 	fmt.Println("Author:", canary.Author)
 	fmt.Println("Expires:", canary.Expiry.String())
-	fmt.Println("Description:\n" + description)
+	if canary.Rotation != nil {
+		fmt.Println("Key rotation:", canary.Rotation.Retire, "->", canary.Rotation.Next)
+	}
+	if opened.Timestamp != nil {
+		fmt.Println("Timestamped:", opened.Timestamp.Format(fugl.CanaryTimeFormat))
+	}
+	for _, anchor := range canary.Freshness {
+		fmt.Println("Freshness:", anchor.Source, "=", anchor.Value)
+	}
+	fmt.Println("Description:\n" + opened.Description)
+}
+
+func verifyTimestamp(flags Flags, opened *fugl.Proof, proof string) {
+	bundle, err := ioutil.ReadFile(flags.TSACerts)
+	if err != nil {
+		exitError(EXIT_FILE_READ_ERROR, "Failed to read timestamp authority certificates: %s", err.Error())
+	}
+	roots, err := fugl.LoadTimestampCertificates(bundle)
+	if err != nil {
+		exitError(EXIT_FILE_READ_ERROR, "Failed to load timestamp authority certificates: %s", err.Error())
+	}
+	path := flags.Timestamp
+	if path == "" {
+		path = flags.Proof + fugl.TimestampFileExtension
+	}
+	token, err := ioutil.ReadFile(path)
+	if err != nil {
+		exitError(EXIT_FILE_READ_ERROR, "Failed to read timestamp: %s", err.Error())
+	}
+	err = fugl.CheckProofTimestamp(opened, roots, proof, token)
+	if err != nil {
+		exitError(EXIT_INVALID_SIGNATURE, "Failed to validate timestamp: %s", err.Error())
+	}
+}
+
+// prints a report of every violated rule
+func printViolations(violations fugl.ValidationErrors) {
+	for _, violation := range violations {
+		line := fmt.Sprintf("%s: %s", violation.Code, violation.Message)
+		if violation.Expected != "" || violation.Actual != "" {
+			line += fmt.Sprintf(" (%s: expected '%s', actual '%s')", violation.Field, violation.Expected, violation.Actual)
+		}
+		fmt.Fprintln(os.Stderr, line)
+	}
 }
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/BurntSushi/toml"
+	"github.com/rot256/fugl"
+)
+
+/* Validation policy (see fugl.PolicyConfig), loaded from a TOML file
+ */
+
+func LoadPolicy(path string) (fugl.Policy, error) {
+	var config fugl.PolicyConfig
+	if path == "" {
+		return fugl.Policy{}, nil
+	}
+	_, err := toml.DecodeFile(path, &config)
+	if err != nil {
+		return fugl.Policy{}, err
+	}
+	return config.Policy(), nil
+}
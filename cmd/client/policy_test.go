@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicy__Example(t *testing.T) {
+	policy, err := LoadPolicy("policy.toml")
+	if err != nil {
+		t.Fatalf("error loading example policy, err=%v", err)
+	}
+	if policy.MaxExpiry != 30*24*time.Hour || policy.ClockSkew != 5*time.Minute {
+		t.Fatalf("unexpected durations in policy: %v", policy)
+	}
+
+	// canaries created from the example manifest satisfy the example policy
+	manifest, err := ParseManifest("manifest.toml")
+	if err != nil {
+		t.Fatalf("error parsing example manifest, err=%v", err)
+	}
+	if time.Duration(manifest.Delta)*time.Second > policy.MaxExpiry {
+		t.Fatal("example manifest violates example policy")
+	}
+
+	if policy, err := LoadPolicy(""); err != nil || policy.MaxExpiry != 0 {
+		t.Fatalf("expected the zero policy without a file, err=%v", err)
+	}
+}
@@ -17,7 +17,7 @@ func actionRunner(command string, state *ServerState) {
 		return
 	}
 	parts := strings.Fields(command)
-	logInfo("Failure action:", parts)
+	logInfo(state.tagged("Failure action:"), parts)
 
 	// wait for deadline
 	for ticker := time.NewTicker(time.Second * 5); ; <-ticker.C {
@@ -33,18 +33,29 @@ func actionRunner(command string, state *ServerState) {
 		expiry := state.latestCanary.Expiry.Time()
 		state.canaryLock.RUnlock()
 		if now.After(expiry) {
-			logInfo("Running failure action")
+			expiry = state.deadline()
+		}
+		if now.After(expiry) {
+			logInfo(state.tagged("Running failure action"))
 			out, err := exec.Command(parts[0], parts[1:]...).Output()
 			if err != nil {
-				logWarning("Failed to execute failure action:", err)
+				logWarning(state.tagged("Failed to execute failure action:"), err)
 			}
-			logInfo("Failure action output:\n" + string(out))
+			logInfo(state.tagged("Failure action output:\n") + string(out))
 			select {} // wait forever
 		}
 
 		// sleep
-		logDebug("Action Runner going to sleep:", expiry.Sub(now).Seconds())
+		logDebug(state.tagged("Action Runner going to sleep:"), expiry.Sub(now).Seconds())
 		time.Sleep(expiry.Sub(now))
-		logDebug("Woke from sleep")
+		logDebug(state.tagged("Woke from sleep"))
 	}
 }
+
+// expiry of the latest canary after reading proofs accepted by servers sharing the store
+func (state *ServerState) deadline() time.Time {
+	state.reload()
+	state.canaryLock.RLock()
+	defer state.canaryLock.RUnlock()
+	return state.latestCanary.Expiry.Time()
+}
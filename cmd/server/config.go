@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/BurntSushi/toml"
+	"github.com/rot256/fugl"
 	"time"
 )
 
@@ -11,28 +12,71 @@ type ConfigLogging struct {
 }
 
 type ConfigServer struct {
-	Port             uint16
-	Address          string
-	TimeoutRead      time.Duration
-	TimeoutWrite     time.Duration
-	CertFile         string `toml:"cert_file"`     // tls: certificate
-	KeyFile          string `toml:"key_file"`      // tls: private key
-	EnableViewSubmit bool   `toml:"enable_submit"` // enable submit view
-	EnableViewStatus bool   `toml:"enable_status"` // enable status view
-	EnableViewLatest bool   `toml:"enable_latest"` // enable latest view
-	EnableViewGetKey bool   `toml:"enable_getkey"` // enable get key view
+	Port              uint16
+	Address           string
+	TimeoutRead       time.Duration
+	TimeoutWrite      time.Duration
+	CertFile          string `toml:"cert_file"`      // tls: certificate
+	KeyFile           string `toml:"key_file"`       // tls: private key
+	EnableViewSubmit  bool   `toml:"enable_submit"`  // enable submit view
+	EnableViewStatus  bool   `toml:"enable_status"`  // enable status view
+	EnableViewLatest  bool   `toml:"enable_latest"`  // enable latest view
+	EnableViewGetKey  bool   `toml:"enable_getkey"`  // enable get key view
+	EnableViewIndex   bool   `toml:"enable_index"`   // enable index of hosted canaries
+	EnableViewHistory bool   `toml:"enable_history"` // enable history and proof by hash views
 }
 
+type ConfigS3 struct {
+	Endpoint  string `toml:"endpoint"`   // e.g. "https://s3.eu-west-1.amazonaws.com"
+	Region    string `toml:"region"`     // region of the bucket (default "us-east-1")
+	Bucket    string `toml:"bucket"`     // bucket for storing proofs
+	Prefix    string `toml:"prefix"`     // prefix of stored objects
+	AccessKey string `toml:"access_key"` // credentials
+	SecretKey string `toml:"secret_key"`
+}
+
+type ConfigRetention struct {
+	KeepLast    int    `toml:"keep_last"`    // keep the newest proofs
+	KeepDays    int    `toml:"keep_days"`    // keep proofs expiring within the last days
+	KeepMonthly bool   `toml:"keep_monthly"` // keep the newest proof expiring in every month
+	ArchiveDir  string `toml:"archive_dir"`  // archives of proofs not retained
+}
+
+const StoreS3 = "s3" // store proofs in the bucket configured in [canary.s3]
+
+const (
+	FsckReport     = "report"
+	FsckQuarantine = "quarantine"
+	FsckOff        = "off"
+)
+
 type ConfigCanary struct {
-	OnFailure string `toml:"on_failure"` // command on failure
-	KeyFile   string `toml:"key_file"`   // load key from this file
-	Store     string `toml:"store"`      // directory for storing canaries
+	OnFailure string            `toml:"on_failure"`       // command on failure
+	Backend   string            `toml:"backend"`          // signature backend: "pgp" (default), "ed25519" or "ssh"
+	KeyFile   string            `toml:"key_file"`         // load key from this file
+	KeyFiles  []string          `toml:"key_files"`        // load additional signer keys from these files
+	Threshold int               `toml:"threshold"`        // number of signers required (default 1)
+	Strict    bool              `toml:"strict"`           // require submitted proofs to have the canonical layout
+	Store     string            `toml:"store"`            // store for canaries: directory or "<kind>:<location>" (see fugl.OpenStore)
+	Migrate   string            `toml:"migrate_from"`     // store to migrate proofs from, when the store is empty
+	Fsck      string            `toml:"fsck"`             // integrity check at startup: "report" (default), "quarantine" or "off"
+	S3        ConfigS3          `toml:"s3"`               // object storage, used when store is "s3"
+	Retention ConfigRetention   `toml:"retention"`        // archival of old proofs (disabled by default)
+	Policy    fugl.PolicyConfig `toml:"policy"`           // validation policy for submitted canaries
+	TSA       string            `toml:"tsa_url"`          // timestamp authority (RFC 3161) for submitted proofs (optional)
+	Refresh   int64             `toml:"refresh_interval"` // seconds between reading proofs accepted by servers sharing the store (default 30 for "s3", otherwise disabled)
+}
+
+// a canary is configured by its public keys
+func (c ConfigCanary) Configured() bool {
+	return c.KeyFile != "" || len(c.KeyFiles) > 0
 }
 
 type Config struct {
-	Logging ConfigLogging `toml:"logging"` // log settings
-	Server  ConfigServer  `toml:"server"`  // http server settings
-	Canary  ConfigCanary  `toml:"canary"`  // canary settings
+	Logging  ConfigLogging           `toml:"logging"`  // log settings
+	Server   ConfigServer            `toml:"server"`   // http server settings
+	Canary   ConfigCanary            `toml:"canary"`   // canary settings (served at the root)
+	Canaries map[string]ConfigCanary `toml:"canaries"` // hosted canaries by name (served under /c/<name>)
 }
 
 func loadConfig() (Config, error) {
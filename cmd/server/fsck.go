@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/rot256/fugl"
+	"os"
+)
+
+/* Checks the integrity of the store (see fugl.CheckStore),
+ * logging every issue and optionally quarantining the offending proofs
+ */
+
+func checkStore(name string, store fugl.Store, verifier fugl.Verifier, quarantine bool, archives []*fugl.Archive) *fugl.StoreReport {
+	report, err := fugl.CheckStore(store, verifier, archives...)
+	if err != nil {
+		logFatal(tagCanary(name, "Failed to check store:"), err)
+	}
+	for _, issue := range report.Issues {
+		logWarning(tagCanary(name, "Store integrity:"), issue.Error())
+	}
+	logInfo(tagCanary(name, "Checked"), report.Checked, "proofs, found", len(report.Issues), "issues")
+	if quarantine && len(report.Issues) > 0 {
+		quarantined, ok := store.(fugl.QuarantineStore)
+		if !ok {
+			logFatal(tagCanary(name, "Store does not support quarantine"))
+		}
+		count, err := fugl.QuarantineIssues(quarantined, report)
+		if err != nil {
+			logFatal(tagCanary(name, "Failed to quarantine proofs:"), err)
+		}
+		logInfo(tagCanary(name, "Quarantined"), count, "proofs")
+	}
+	return report
+}
+
+/* Standalone integrity check (-fsck) of every canary,
+ * exits with a non-zero status if issues were found
+ */
+
+func runFsck(config Config) {
+	issues := 0
+	for _, h := range hostedCanaries(config) {
+		logInfo("Checking canary:", describeHosted(h.name))
+		store, err := openStore(h.config)
+		if err != nil {
+			logFatal(tagCanary(h.name, "Unable to open store:"), err)
+		}
+		archives := loadArchives(h.config.Retention)
+		report := checkStore(h.name, store, loadVerifier(h.name, h.config), *FlagQuarantine, archives)
+		issues += len(report.Issues)
+	}
+	if issues > 0 {
+		os.Exit(1)
+	}
+}
@@ -1,26 +1,87 @@
 package main
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"github.com/rot256/fugl"
-	"golang.org/x/crypto/openpgp"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
 
 type ServerState struct {
-	storeDir       string          // directory for storing new canaries
-	latestCanary   *fugl.Canary    // cached latest canary (parsed proof)
-	latestProof    string          // newest proof
-	canaryKey      *openpgp.Entity // parsed public key
-	canaryKeyArmor string          // ascii armored pgp key
+	name           string        // name of hosted canary (empty for [canary])
+	store          fugl.Store    // persistence of accepted proofs
+	latestCanary   *fugl.Canary  // cached latest canary (parsed proof)
+	latestProof    string        // newest proof
+	latestSigners  []string      // fingerprints of keys signing newest proof
+	latestToken    []byte        // timestamp token over newest proof (may be nil)
+	canaryVerifier fugl.Verifier // verifier for signatures on proofs
+	configVerifier fugl.Verifier // verifier for the oldest proof (configured keys)
+	canaryKeyArmor string        // armored public keys
+	canaryStrict   bool          // parse submitted proofs strictly
+	canaryPolicy   fugl.Policy   // validation policy for submitted canaries
+	timestampURL   string        // timestamp authority (empty if disabled)
+	history        History       // proofs of the verified chain
 	canaryLock     sync.RWMutex
 }
 
-func SendRequestError(w http.ResponseWriter, msg string) {
-	w.WriteHeader(http.StatusBadRequest)
-	w.Write([]byte(msg))
-	return
+const (
+	TimestampTimeout = 10 * time.Second
+	StoreTimeout     = 30 * time.Second
+)
+
+// prefixes log messages of hosted canaries with the name
+func tagCanary(name string, msg string) string {
+	if name == "" {
+		return msg
+	}
+	return "[" + name + "] " + msg
+}
+
+func (state *ServerState) tagged(msg string) string {
+	return tagCanary(state.name, msg)
+}
+
+/* Requests a timestamp over the proof and stores it alongside the proof */
+
+func requestTimestamp(url string, proof string, store fugl.Store) ([]byte, error) {
+	timestamps, ok := store.(fugl.TimestampStore)
+	if !ok {
+		return nil, errors.New("Store does not support timestamps")
+	}
+	client := &http.Client{Timeout: TimestampTimeout}
+	token, err := fugl.RequestTimestamp(client, url, proof)
+	if err != nil {
+		return nil, err
+	}
+	err = timestamps.SaveTimestamp(fugl.HashString(proof), token)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+/* Sends the error as a JSON body (see fugl.ValidationError),
+ * errors without a code are reported as invalid proofs
+ */
+
+func SendRequestError(w http.ResponseWriter, status int, err error) {
+	body, ok := err.(*fugl.ValidationError)
+	if !ok {
+		body = &fugl.ValidationError{Code: fugl.ErrCodeInvalidProof, Message: err.Error()}
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		logError("Failed to encode error:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(encoded)
 }
 
 /* Serves the public key */
@@ -30,6 +91,8 @@ type GetKeyHandler struct {
 }
 
 func (h *GetKeyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.state.canaryLock.RLock()
+	defer h.state.canaryLock.RUnlock()
 	if h.state.canaryKeyArmor == "" {
 		w.WriteHeader(http.StatusNoContent)
 		return
@@ -52,6 +115,10 @@ func (h *LatestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set(fugl.SERVER_SIGNERS_HEADER, strings.Join(h.state.latestSigners, ", "))
+	if h.state.latestToken != nil {
+		w.Header().Set(fugl.SERVER_TIMESTAMP_HEADER, base64.StdEncoding.EncodeToString(h.state.latestToken))
+	}
 	w.Write([]byte(h.state.latestProof))
 }
 
@@ -65,54 +132,117 @@ func (h *SubmitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// parse and verify signature
 	proof := r.PostFormValue(fugl.SERVER_SUBMIT_FIELD_NAME)
 	if proof == "" {
-		SendRequestError(w, "No proof form attribute specified")
-		return
-	}
-	logDebug("New proof submission:\n", proof)
-
-	canary, _, err := fugl.OpenProof(h.state.canaryKey, proof)
-	if err != nil {
-		SendRequestError(w, err.Error())
+		SendRequestError(w, http.StatusBadRequest, &fugl.ValidationError{
+			Code:    fugl.ErrCodeMissingProof,
+			Field:   fugl.SERVER_SUBMIT_FIELD_NAME,
+			Message: "No proof form attribute specified",
+		})
 		return
 	}
-	if canary == nil {
-		SendRequestError(w, "Unable to load canary from proof")
+	logDebug(h.state.tagged("New proof submission:\n"), proof)
+	opened, ok := h.accept(w, proof)
+	if !ok {
 		return
 	}
 
-	// check version field
-	if canary.Version != fugl.CanaryVersion {
-		logWarning("Invalid canary version field")
-		SendRequestError(w, "Unsupported canary version")
-		return
+	// obtain timestamp (optional, the proof is accepted regardless),
+	// without holding the lock as the authority may be slow
+	if h.state.timestampURL != "" {
+		token, err := requestTimestamp(h.state.timestampURL, proof, h.state.store)
+		if err != nil {
+			logWarning(h.state.tagged("Failed to timestamp proof:"), err)
+		} else {
+			h.state.canaryLock.Lock()
+			if h.state.latestProof == proof {
+				h.state.latestToken = token
+			}
+			h.state.canaryLock.Unlock()
+		}
 	}
+	logInfo(h.state.tagged("Succesfully added a new canary, signed by:"), strings.Join(opened.Signers, ", "))
+	w.Header().Set(fugl.SERVER_SIGNERS_HEADER, strings.Join(opened.Signers, ", "))
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	// verify expires in the future
-	if time.Now().After(canary.Expiry.Time()) {
-		SendRequestError(w, "Canary must have a deadline in the future")
-		return
-	}
+/* Verifies and saves the proof, making it the latest proof.
+ * Sends the error response if the proof is rejected.
+ */
 
-	// take write lock
+func (h *SubmitHandler) accept(w http.ResponseWriter, proof string) (*fugl.Proof, bool) {
+	// take write lock (keys may be rotated)
 	h.state.canaryLock.Lock()
 	defer h.state.canaryLock.Unlock()
 
-	// verify canary fields
-	err = fugl.CheckCanary(canary, h.state.latestCanary, time.Now())
+	verify := fugl.VerifyProof
+	if h.state.canaryStrict {
+		verify = fugl.VerifyProofStrict
+	}
+	opened, err := verify(h.state.canaryVerifier, proof)
 	if err != nil {
-		SendRequestError(w, err.Error())
-		return
+		SendRequestError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	canary := opened.Canary
+	if canary == nil {
+		SendRequestError(w, http.StatusBadRequest, errors.New("Unable to load canary from proof"))
+		return nil, false
+	}
+
+	// verify canary fields (version, expiry in the future, link to latest proof)
+	err = h.state.canaryPolicy.Check(canary, h.state.latestCanary, h.state.latestProof, time.Now())
+	if err != nil {
+		logDebug(h.state.tagged("Rejected canary:"), fugl.ErrorCode(err))
+		SendRequestError(w, http.StatusBadRequest, err)
+		return nil, false
 	}
 
-	// save to disk
-	err = fugl.SaveToDirectory(proof, h.state.storeDir, canary.Expiry.Time())
+	// follow announced key rotation
+	verifier, err := h.state.canaryVerifier.Rotate(canary.Rotation)
+	if err != nil {
+		SendRequestError(w, http.StatusBadRequest, &fugl.ValidationError{
+			Code:    fugl.ErrCodeInvalidRotation,
+			Field:   "rotation",
+			Message: err.Error(),
+		})
+		return nil, false
+	}
+	keyArmor, err := verifier.PublicKeys()
 	if err != nil {
-		logError("Failed to save valid proof to store:", err)
+		logError(h.state.tagged("Failed to armor rotated keys:"), err)
 		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return nil, false
+	}
+
+	// save to store
+	err = h.state.store.Save(proof, canary)
+	if err == fugl.ErrStoreConflict {
+		// another server accepted a proof, catch up
+		logWarning(h.state.tagged("Store modified concurrently, refreshing latest proof"))
+		if err := h.state.refresh(); err != nil {
+			logError(h.state.tagged("Failed to refresh from store:"), err)
+		}
+		SendRequestError(w, http.StatusConflict, &fugl.ValidationError{
+			Code:    fugl.ErrCodeConflict,
+			Field:   "previous",
+			Message: "Canary does not supersede the latest canary, please retry",
+		})
+		return nil, false
 	}
+	if err != nil {
+		logError(h.state.tagged("Failed to save valid proof to store:"), err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+
 	h.state.latestProof = proof
 	h.state.latestCanary = canary
-	logInfo("Succesfully added a new canary")
-	w.WriteHeader(http.StatusNoContent)
+	h.state.latestSigners = opened.Signers
+	h.state.latestToken = nil
+	h.state.history.add(proof, canary)
+	if canary.Rotation != nil {
+		logInfo(h.state.tagged("Rotated key:"), canary.Rotation.Retire, "->", canary.Rotation.Next)
+		h.state.canaryVerifier = verifier
+		h.state.canaryKeyArmor = keyArmor
+	}
+	return opened, true
 }
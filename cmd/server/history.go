@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/rot256/fugl"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* History of the served chain (oldest first),
+ * allowing clients to fetch every stored proof and verify the chain from the configured keys.
+ *
+ * Only proofs of the verified chain are listed and served (see follow),
+ * proofs moved into archives by the retention policy are removed.
+ */
+
+const (
+	HistoryDefaultLimit = 100
+	HistoryMaxLimit     = 1000
+)
+
+var proofHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+type HistoryEntry struct {
+	Hash     string          `json:"hash"`
+	Previous string          `json:"previous,omitempty"` // hash of the preceding proof
+	Creation fugl.CanaryTime `json:"creation"`
+	Expiry   fugl.CanaryTime `json:"expiry"`
+	Path     string          `json:"path"` // the proof is served at this path
+}
+
+type HistoryPage struct {
+	Proofs []HistoryEntry `json:"proofs"`
+	Next   string         `json:"next,omitempty"` // value of "from" for the next page in UTC (empty on the last page)
+}
+
+type History struct {
+	prefix  string // path of the proof view
+	entries []HistoryEntry
+	hashes  map[string]bool
+}
+
+func (h *History) add(proof string, canary *fugl.Canary) {
+	hash := fugl.HashString(proof)
+	if h.hashes == nil {
+		h.hashes = make(map[string]bool)
+	}
+	if h.hashes[hash] {
+		return
+	}
+	h.hashes[hash] = true
+	h.entries = append(h.entries, HistoryEntry{
+		Hash:     hash,
+		Previous: canary.Previous,
+		Creation: canary.Creation,
+		Expiry:   canary.Expiry,
+		Path:     h.prefix + hash,
+	})
+}
+
+func (h *History) contains(hash string) bool {
+	return h.hashes[hash]
+}
+
+func (h *History) remove(hashes []string) {
+	for _, hash := range hashes {
+		delete(h.hashes, hash)
+	}
+	entries := h.entries[:0]
+	for _, entry := range h.entries {
+		if h.hashes[entry.Hash] {
+			entries = append(entries, entry)
+		}
+	}
+	h.entries = entries
+}
+
+// at most limit entries expiring at or after from (zero is unbounded)
+func (h *History) page(from time.Time, limit int) HistoryPage {
+	page := HistoryPage{Proofs: []HistoryEntry{}}
+	for _, entry := range h.entries {
+		if entry.Expiry.Time().Before(from) {
+			continue
+		}
+		if limit > 0 && len(page.Proofs) == limit {
+			page.Next = entry.Expiry.Time().UTC().Format(fugl.CanaryTimeFormat)
+			break
+		}
+		page.Proofs = append(page.Proofs, entry)
+	}
+	return page
+}
+
+/* Removes proofs moved into an archive (by the retention policy) from the history
+ */
+
+func (state *ServerState) forgetArchived(entries []fugl.ArchiveEntry) {
+	hashes := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		hashes = append(hashes, entry.Hash)
+	}
+	state.history.remove(hashes)
+}
+
+/* Serves a page of the history (as JSON),
+ * the query parameters "from" (expiry, e.g. "2017-01-01T00:00:00Z") and "limit" select the page
+ */
+
+type HistoryHandler struct {
+	state *ServerState
+}
+
+func (h *HistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var from time.Time
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = time.Parse(fugl.CanaryTimeFormat, value)
+		if err != nil {
+			http.Error(w, "Invalid from time, expected format: "+fugl.CanaryTimeFormat, http.StatusBadRequest)
+			return
+		}
+	}
+	limit := HistoryDefaultLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > HistoryMaxLimit {
+			http.Error(w, "Invalid limit, expected 1 to "+strconv.Itoa(HistoryMaxLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	h.state.canaryLock.RLock()
+	page := h.state.history.page(from, limit)
+	h.state.canaryLock.RUnlock()
+	encoded, err := json.MarshalIndent(page, "", "  ")
+	if err != nil {
+		logError(h.state.tagged("Failed to encode history:"), err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(encoded)
+}
+
+/* Serves a proof of the history by hash (/proof/<sha256>) */
+
+type ProofHandler struct {
+	state  *ServerState
+	prefix string // path preceding the hash
+}
+
+func (h *ProofHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	hash := strings.TrimPrefix(r.URL.Path, h.prefix)
+	if !proofHashPattern.MatchString(hash) {
+		http.NotFound(w, r)
+		return
+	}
+	h.state.canaryLock.RLock()
+	defer h.state.canaryLock.RUnlock()
+	if !h.state.history.contains(hash) {
+		http.NotFound(w, r)
+		return
+	}
+	proof, err := h.state.store.Get(hash)
+	if err == fugl.ErrProofNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logError(h.state.tagged("Failed to read proof from store:"), err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if timestamps, ok := h.state.store.(fugl.TimestampStore); ok {
+		token, err := timestamps.Timestamp(hash)
+		if err != nil {
+			logWarning(h.state.tagged("Failed to read timestamp from store:"), err)
+		}
+		if token != nil {
+			w.Header().Set(fugl.SERVER_TIMESTAMP_HEADER, base64.StdEncoding.EncodeToString(token))
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(proof))
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/rot256/fugl"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func newHistoryState(t *testing.T, count int) (*ServerState, []string) {
+	dir, err := ioutil.TempDir("", "fugl-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := fugl.NewDirectoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &ServerState{store: store}
+	state.history.prefix = canaryPath("acme", fugl.SERVER_PROOF_PATH)
+
+	// signer one hour ahead of UTC
+	zone := time.FixedZone("CET", 60*60)
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, zone)
+	var proofs []string
+	for i := 0; i < count; i++ {
+		proof := "proof " + string(rune('a'+i))
+		canary := fugl.Canary{
+			Creation: fugl.CanaryTime(start.Add(time.Duration(i) * time.Hour)),
+			Expiry:   fugl.CanaryTime(start.Add(time.Duration(i+1) * time.Hour)),
+		}
+		if i > 0 {
+			canary.Previous = fugl.HashString(proofs[i-1])
+		}
+		if err := store.Save(proof, &canary); err != nil {
+			t.Fatal(err)
+		}
+		state.history.add(proof, &canary)
+		proofs = append(proofs, proof)
+	}
+	return state, proofs
+}
+
+func getHistory(t *testing.T, state *ServerState, query string) (int, HistoryPage) {
+	w := httptest.NewRecorder()
+	(&HistoryHandler{state: state}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/c/acme/history?"+query, nil))
+	var page HistoryPage
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("error decoding history, err=%v", err)
+		}
+	}
+	return w.Code, page
+}
+
+func TestHistory__Page(t *testing.T) {
+	state, proofs := newHistoryState(t, 5)
+	defer os.RemoveAll(state.store.(*fugl.DirectoryStore).Dir)
+
+	// follow the pages, passing next unescaped
+	var hashes []string
+	query := "limit=2"
+	for pages := 0; ; pages++ {
+		status, page := getHistory(t, state, query)
+		if status != http.StatusOK || pages > len(proofs) {
+			t.Fatalf("unexpected status %d for query %q", status, query)
+		}
+		for _, entry := range page.Proofs {
+			hashes = append(hashes, entry.Hash)
+			if entry.Path != "/c/acme/proof/"+entry.Hash {
+				t.Fatalf("unexpected path: %s", entry.Path)
+			}
+		}
+		if page.Next == "" {
+			break
+		}
+		if page.Next[len(page.Next)-1] != 'Z' {
+			t.Fatalf("expected next in UTC, got %s", page.Next)
+		}
+		query = "limit=2&from=" + page.Next
+	}
+	if len(hashes) != len(proofs) {
+		t.Fatalf("expected %d proofs, got %d", len(proofs), len(hashes))
+	}
+	for i, proof := range proofs {
+		if hashes[i] != fugl.HashString(proof) {
+			t.Fatalf("unexpected proof %d in history", i)
+		}
+	}
+
+	// an offset in from is honored when escaped
+	from := url.QueryEscape(time.Date(2017, 1, 1, 3, 0, 0, 0, time.FixedZone("CET", 60*60)).Format(fugl.CanaryTimeFormat))
+	if _, page := getHistory(t, state, "from="+from); len(page.Proofs) != 3 {
+		t.Fatalf("expected 3 proofs expiring from the offset time, got %d", len(page.Proofs))
+	}
+
+	if page := state.history.page(time.Time{}, 0); len(page.Proofs) != len(proofs) || page.Next != "" {
+		t.Fatalf("expected all proofs without a limit, got %d", len(page.Proofs))
+	}
+
+	for _, query := range []string{"limit=0", "limit=1001", "limit=x", "from=yesterday"} {
+		if status, _ := getHistory(t, state, query); status != http.StatusBadRequest {
+			t.Fatalf("expected bad request for %q, got %d", query, status)
+		}
+	}
+
+	// removed (archived) proofs are no longer listed
+	state.history.remove([]string{fugl.HashString(proofs[0]), fugl.HashString(proofs[1])})
+	if _, page := getHistory(t, state, ""); len(page.Proofs) != 3 || page.Proofs[0].Hash != fugl.HashString(proofs[2]) {
+		t.Fatalf("unexpected history after removal: %v", page.Proofs)
+	}
+}
+
+func TestHistory__Proof(t *testing.T) {
+	state, proofs := newHistoryState(t, 2)
+	defer os.RemoveAll(state.store.(*fugl.DirectoryStore).Dir)
+	handler := &ProofHandler{state: state, prefix: canaryPath("acme", fugl.SERVER_PROOF_PATH)}
+	get := func(hash string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/c/acme/proof/"+hash, nil))
+		return w
+	}
+
+	if w := get(fugl.HashString(proofs[1])); w.Code != http.StatusOK || w.Body.String() != proofs[1] {
+		t.Fatalf("unexpected response %d: %q", w.Code, w.Body.String())
+	}
+	if w := get("nothex"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected not found for malformed hash, got %d", w.Code)
+	}
+	if w := get(fugl.HashString("unknown")); w.Code != http.StatusNotFound {
+		t.Fatalf("expected not found for unknown hash, got %d", w.Code)
+	}
+
+	// stored, but not part of the served chain
+	orphan := fugl.Canary{Expiry: fugl.CanaryTime(time.Now())}
+	state.store.Save("orphan", &orphan)
+	if w := get(fugl.HashString("orphan")); w.Code != http.StatusNotFound {
+		t.Fatalf("expected not found for proof outside the chain, got %d", w.Code)
+	}
+	state.history.remove([]string{fugl.HashString(proofs[0])})
+	if w := get(fugl.HashString(proofs[0])); w.Code != http.StatusNotFound {
+		t.Fatalf("expected not found for removed proof, got %d", w.Code)
+	}
+}
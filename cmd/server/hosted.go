@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/rot256/fugl"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+/* Hosting many canaries in one server:
+ * every [canaries.<name>] table configures a canary (keys, store, policy, failure action, ...),
+ * served under /c/<name> alongside the [canary] table served at the root.
+ */
+
+var hostedNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+type HostedCanary struct {
+	name   string       // empty for the [canary] table
+	config ConfigCanary // settings of the canary
+	state  *ServerState
+}
+
+// path of a view of the canary
+func (h *HostedCanary) path(view string) string {
+	return canaryPath(h.name, view)
+}
+
+func canaryPath(name string, view string) string {
+	if name == "" {
+		return view
+	}
+	joined := path.Join(fugl.SERVER_CANARIES_PATH, name, view)
+	if strings.HasSuffix(view, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+/* Returns the configured canaries ([canary] first, followed by [canaries] ordered by name),
+ * checking that names are valid and canaries do not share a store or archive directory
+ */
+
+func hostedCanaries(config Config) []*HostedCanary {
+	var hosted []*HostedCanary
+	if config.Canary.Configured() || len(config.Canaries) == 0 {
+		hosted = append(hosted, &HostedCanary{config: config.Canary})
+	}
+	names := make([]string, 0, len(config.Canaries))
+	for name := range config.Canaries {
+		if !hostedNamePattern.MatchString(name) {
+			logFatal("Config: invalid canary name (lowercase letters, digits, '-' and '_'):", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		hosted = append(hosted, &HostedCanary{name: name, config: config.Canaries[name]})
+	}
+
+	stores := make(map[string]string)
+	archives := make(map[string]string)
+	for _, h := range hosted {
+		store := storeLocation(h.config)
+		if other, ok := stores[store]; ok {
+			logFatal("Config: canaries", describeHosted(other), "and", describeHosted(h.name), "share a store")
+		}
+		stores[store] = h.name
+
+		if h.config.Retention.ArchiveDir == "" {
+			continue
+		}
+		archive := cleanLocation(h.config.Retention.ArchiveDir)
+		if other, ok := archives[archive]; ok {
+			logFatal("Config: canaries", describeHosted(other), "and", describeHosted(h.name), "share an archive directory")
+		}
+		archives[archive] = h.name
+	}
+	return hosted
+}
+
+// location of the store, equal for specs of the same store (e.g. "./proofs" and "dir:proofs")
+func storeLocation(config ConfigCanary) string {
+	if config.Store == StoreS3 {
+		endpoint := strings.TrimRight(config.S3.Endpoint, "/")
+		return StoreS3 + ":" + endpoint + "/" + config.S3.Bucket + "/" + config.S3.Prefix
+	}
+	_, location := fugl.ParseStoreSpec(config.Store)
+	return cleanLocation(location)
+}
+
+func cleanLocation(location string) string {
+	abs, err := filepath.Abs(location)
+	if err != nil {
+		return filepath.Clean(location)
+	}
+	return abs
+}
+
+func describeHosted(name string) string {
+	if name == "" {
+		return "[canary]"
+	}
+	return "[canaries." + name + "]"
+}
+
+/* Serves the index of hosted canaries (as JSON) */
+
+type IndexEntry struct {
+	Name     string           `json:"name"`
+	Path     string           `json:"path"`               // views are served under this path
+	Author   string           `json:"author,omitempty"`   // author of the latest canary
+	Creation *fugl.CanaryTime `json:"creation,omitempty"` // creation of the latest canary
+	Expiry   *fugl.CanaryTime `json:"expiry,omitempty"`   // expiry of the latest canary
+	Expired  bool             `json:"expired"`            // the latest canary has expired (or none was submitted)
+	Final    bool             `json:"final"`              // the latest canary is final
+}
+
+type IndexHandler struct {
+	hosted []*HostedCanary
+}
+
+func (h *IndexHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the index path is a subtree, unknown paths below it are not found
+	if r.URL.Path != fugl.SERVER_CANARIES_PATH {
+		http.NotFound(w, r)
+		return
+	}
+	entries := []IndexEntry{}
+	now := time.Now()
+	for _, hosted := range h.hosted {
+		if hosted.name == "" {
+			continue
+		}
+		entry := IndexEntry{Name: hosted.name, Path: hosted.path(""), Expired: true}
+		hosted.state.canaryLock.RLock()
+		if canary := hosted.state.latestCanary; canary != nil {
+			creation, expiry := canary.Creation, canary.Expiry
+			entry.Author = canary.Author
+			entry.Creation = &creation
+			entry.Expiry = &expiry
+			entry.Expired = now.After(expiry.Time())
+			entry.Final = canary.Final
+		}
+		hosted.state.canaryLock.RUnlock()
+		entries = append(entries, entry)
+	}
+	encoded, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		logError("Failed to encode index:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(encoded)
+}
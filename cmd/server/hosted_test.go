@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/rot256/fugl"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// configures a hosted canary with a key and the store
+func hostedConfig(store string) ConfigCanary {
+	return ConfigCanary{KeyFile: "key.asc", Store: store}
+}
+
+// hostedCanaries with the configured canaries, recovering from fatal errors
+func checkHosted(config Config) (hosted []*HostedCanary, fatal bool) {
+	defer func() {
+		if recover() != nil {
+			fatal = true
+		}
+	}()
+	return hostedCanaries(config), false
+}
+
+func TestHosted__Path(t *testing.T) {
+	cases := []struct {
+		name, view, path string
+	}{
+		{"", fugl.SERVER_LATEST_PATH, "/latest"},
+		{"", fugl.SERVER_PROOF_PATH, "/proof/"},
+		{"acme", fugl.SERVER_LATEST_PATH, "/c/acme/latest"},
+		{"acme", fugl.SERVER_PROOF_PATH, "/c/acme/proof/"},
+		{"acme", "", "/c/acme"},
+	}
+	for _, test := range cases {
+		if path := canaryPath(test.name, test.view); path != test.path {
+			t.Fatalf("expected %s, got %s", test.path, path)
+		}
+	}
+}
+
+func TestHosted__Names(t *testing.T) {
+	config := Config{Canaries: map[string]ConfigCanary{
+		"zeta":   hostedConfig("zeta"),
+		"acme":   hostedConfig("acme"),
+		"beta-2": hostedConfig("bolt:beta.db"),
+	}}
+	hosted, fatal := checkHosted(config)
+	if fatal {
+		t.Fatal("unexpected fatal error for valid names")
+	}
+	var names []string
+	for _, h := range hosted {
+		names = append(names, h.name)
+	}
+	if len(names) != 3 || names[0] != "acme" || names[1] != "beta-2" || names[2] != "zeta" {
+		t.Fatalf("expected canaries ordered by name, got %v", names)
+	}
+
+	// [canary] is served first when configured
+	config.Canary = hostedConfig("root")
+	if hosted, _ := checkHosted(config); len(hosted) != 4 || hosted[0].name != "" {
+		t.Fatal("expected [canary] first")
+	}
+
+	for _, name := range []string{"", "Acme", "-acme", "acme/beta", "acme beta", ".."} {
+		config := Config{Canaries: map[string]ConfigCanary{name: hostedConfig("acme")}}
+		if _, fatal := checkHosted(config); !fatal {
+			t.Fatalf("expected invalid name %q to be rejected", name)
+		}
+	}
+}
+
+func TestHosted__SharedStore(t *testing.T) {
+	shared := [][2]string{
+		{"proofs", "./proofs"},
+		{"proofs", "dir:./proofs"},
+		{"dir:proofs/", "dir:./other/../proofs"},
+		{"bolt:canary.db", "bolt:./canary.db"},
+		{"proofs", "git:proofs"},
+	}
+	for _, stores := range shared {
+		config := Config{Canaries: map[string]ConfigCanary{
+			"acme": hostedConfig(stores[0]),
+			"beta": hostedConfig(stores[1]),
+		}}
+		if _, fatal := checkHosted(config); !fatal {
+			t.Fatalf("expected stores %q and %q to be shared", stores[0], stores[1])
+		}
+	}
+
+	// the same bucket with different prefixes is not shared
+	acme := hostedConfig(StoreS3)
+	acme.S3 = ConfigS3{Endpoint: "https://s3.example.com", Bucket: "canaries", Prefix: "acme/"}
+	beta := acme
+	beta.S3.Prefix = "beta/"
+	config := Config{Canaries: map[string]ConfigCanary{"acme": acme, "beta": beta}}
+	if _, fatal := checkHosted(config); fatal {
+		t.Fatal("unexpected fatal error for distinct prefixes")
+	}
+	beta.S3 = acme.S3
+	beta.S3.Endpoint += "/"
+	config.Canaries["beta"] = beta
+	if _, fatal := checkHosted(config); !fatal {
+		t.Fatal("expected the bucket to be shared")
+	}
+}
+
+func TestHosted__SharedArchive(t *testing.T) {
+	acme := hostedConfig("acme")
+	acme.Retention.ArchiveDir = "archives"
+	beta := hostedConfig("beta")
+	beta.Retention.ArchiveDir = "./archives/"
+	config := Config{Canaries: map[string]ConfigCanary{"acme": acme, "beta": beta}}
+	if _, fatal := checkHosted(config); !fatal {
+		t.Fatal("expected the archive directory to be shared")
+	}
+
+	beta.Retention.ArchiveDir = "archives/beta"
+	config.Canaries["beta"] = beta
+	if _, fatal := checkHosted(config); fatal {
+		t.Fatal("unexpected fatal error for distinct archive directories")
+	}
+}
+
+func TestHosted__Index(t *testing.T) {
+	now := time.Now().Add(-time.Minute)
+	hosted := []*HostedCanary{
+		{state: &ServerState{}},
+		{name: "acme", state: &ServerState{latestCanary: &fugl.Canary{
+			Author:   "John Doe",
+			Creation: fugl.CanaryTime(now),
+			Expiry:   fugl.CanaryTime(now.Add(time.Hour)),
+		}}},
+		{name: "beta", state: &ServerState{latestCanary: &fugl.Canary{
+			Creation: fugl.CanaryTime(now.Add(-2 * time.Hour)),
+			Expiry:   fugl.CanaryTime(now.Add(-time.Hour)),
+			Final:    true,
+		}}},
+		{name: "zeta", state: &ServerState{}},
+	}
+	handler := &IndexHandler{hosted: hosted}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fugl.SERVER_CANARIES_PATH, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	var entries []IndexEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("error decoding index, err=%v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 hosted canaries (without [canary]), got %d", len(entries))
+	}
+
+	acme, beta, zeta := entries[0], entries[1], entries[2]
+	if acme.Name != "acme" || acme.Path != "/c/acme" || acme.Author != "John Doe" || acme.Expired || acme.Final {
+		t.Fatalf("unexpected entry: %+v", acme)
+	}
+	if acme.Expiry == nil || !acme.Expiry.Time().Equal(fugl.CanaryTime(now.Add(time.Hour)).Time()) {
+		t.Fatalf("unexpected expiry: %v", acme.Expiry)
+	}
+	if beta.Name != "beta" || !beta.Expired || !beta.Final {
+		t.Fatalf("unexpected entry: %+v", beta)
+	}
+	if zeta.Name != "zeta" || !zeta.Expired || zeta.Creation != nil || zeta.Expiry != nil {
+		t.Fatalf("unexpected entry without canary: %+v", zeta)
+	}
+
+	// paths below the index are not found
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fugl.SERVER_CANARIES_PATH+"/acme", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected not found, got %d", w.Code)
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"os"
 )
 
-var FlagConfigPath = flag.String("config", "config.toml", "path to config file")
+var (
+	FlagConfigPath = flag.String("config", "config.toml", "path to config file")
+	FlagFsck       = flag.Bool("fsck", false, "check the integrity of the store and exit")
+	FlagQuarantine = flag.Bool("quarantine", false, "quarantine offending proofs found by -fsck")
+)
 
 func init() {
-	flag.Parse()
 	log.SetFlags(0)
 	log.SetOutput(logWriter{os.Stdout})
 }
@@ -1,83 +1,248 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"github.com/rot256/fugl"
 	"io/ioutil"
 	"net/http"
-	"os"
+	"time"
 )
 
-func createDir(path string) error {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return os.MkdirAll(path, os.ModePerm)
-	}
-	return nil
-}
+/* One-shot migration of proofs from an old store,
+ * skipped once the store contains proofs
+ */
 
-func createState(config Config) *ServerState {
-	// read public key
-	var state ServerState
-	key, err := ioutil.ReadFile(config.Canary.KeyFile)
+func migrateStore(name string, store fugl.Store, from string, verifier fugl.Verifier) {
+	count, err := store.Count()
 	if err != nil {
-		logFatal("Unable to load public key from:", config.Canary.KeyFile)
+		logFatal(tagCanary(name, "Unable to read store:"), err)
 	}
-	state.canaryKeyArmor = string(key)
-	state.canaryKey, err = fugl.PGPLoadPublicKey(key)
+	if count > 0 {
+		logInfo(tagCanary(name, "Store not empty, skipping migration from:"), from)
+		return
+	}
+	src, err := fugl.OpenStore(from)
+	if err != nil {
+		logFatal(tagCanary(name, "Unable to open store to migrate from:"), err)
+	}
+	count, err = fugl.MigrateStore(store, src, verifier)
 	if err != nil {
-		logFatal("Unable to parse PGP key:", err)
+		logFatal(tagCanary(name, "Failed to migrate proofs:"), err)
 	}
+	logInfo(tagCanary(name, "Migrated"), count, "proofs from:", from)
+}
 
-	// load latest proof
-	err = createDir(config.Canary.Store)
+func loadVerifier(name string, config ConfigCanary) fugl.Verifier {
+	var keys []byte
+	var keyFiles []string
+	if config.KeyFile != "" {
+		keyFiles = append(keyFiles, config.KeyFile)
+	}
+	keyFiles = append(keyFiles, config.KeyFiles...)
+	if len(keyFiles) == 0 {
+		logFatal(tagCanary(name, "No public key configured"))
+	}
+	for _, keyFile := range keyFiles {
+		key, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			logFatal(tagCanary(name, "Unable to load public key from:"), keyFile)
+		}
+		keys = append(keys, key...)
+		keys = append(keys, '\n')
+	}
+	backend := config.Backend
+	if backend == "" {
+		backend = fugl.BackendPGP
+	}
+	verifier, err := fugl.LoadVerifier(backend, keys, config.Threshold)
 	if err != nil {
-		logFatal("Unable to create store:", err)
+		logFatal(tagCanary(name, "Unable to load public keys:"), err)
 	}
-	state.latestProof, err = fugl.LoadLatestProof(config.Canary.Store)
+	logInfo(tagCanary(name, "Signature backend:"), backend)
+	return verifier
+}
+
+func createState(name string, config ConfigCanary) *ServerState {
+	// read public keys of signers
+	var state ServerState
+	var err error
+	state.name = name
+	state.history.prefix = canaryPath(name, fugl.SERVER_PROOF_PATH)
+	verifier := loadVerifier(name, config)
+	state.canaryVerifier = verifier
+	state.configVerifier = verifier
+	state.canaryStrict = config.Strict
+	state.canaryPolicy = config.Policy.Policy()
+	state.timestampURL = config.TSA
+
+	// load stored proofs
+	state.store, err = openStore(config)
 	if err != nil {
-		logFatal("Failed to load latest proof")
+		logFatal(state.tagged("Unable to create store:"), err)
+	}
+	if config.Migrate != "" {
+		migrateStore(name, state.store, config.Migrate, verifier)
+	}
+	if retentionPolicy(config.Retention).Enabled() && config.Retention.ArchiveDir == "" {
+		logFatal(state.tagged("Config: retention requires archive_dir"))
+	}
+
+	// check integrity, serving only the valid chain
+	var proofs []string
+	switch config.Fsck {
+	case "", FsckReport, FsckQuarantine, FsckOff:
+	default:
+		logFatal(state.tagged("Config: fsck must be \"report\", \"quarantine\" or \"off\""))
+	}
+	if config.Fsck == FsckOff {
+		proofs, err = state.store.List(time.Time{}, time.Time{})
+		if err != nil {
+			logFatal(state.tagged("Failed to load proofs"))
+		}
+	} else {
+		archives := loadArchives(config.Retention)
+		proofs = checkStore(name, state.store, verifier, config.Fsck == FsckQuarantine, archives).Chain
 	}
 
-	// parse latest proof
-	if state.latestProof != "" {
-		state.latestCanary, _, err = fugl.OpenProof(state.canaryKey, state.latestProof)
+	// parse proofs, following key rotations
+	err = state.follow(proofs)
+	if err != nil {
+		logFatal(state.tagged("Failed to load stored canary:"), err.Error())
+	}
+	if state.canaryKeyArmor == "" {
+		state.canaryKeyArmor, err = state.canaryVerifier.PublicKeys()
 		if err != nil {
-			logFatal("Failed to load latest canary:", err.Error())
+			logFatal(state.tagged("Failed to armor public keys:"), err)
 		}
 	}
-	state.storeDir = config.Canary.Store
 	return &state
 }
 
-func buildHandler(config Config) (http.Handler, *ServerState) {
-	state := createState(config)
-	handler := http.NewServeMux()
-	if config.Server.EnableViewSubmit {
-		logInfo("Enable view: Submit")
-		handler.Handle(fugl.SERVER_SUBMIT_PATH, &SubmitHandler{state: state})
+func openStore(config ConfigCanary) (fugl.Store, error) {
+	if config.Store == StoreS3 {
+		return fugl.NewS3Store(fugl.S3Config{
+			Endpoint:  config.S3.Endpoint,
+			Region:    config.S3.Region,
+			Bucket:    config.S3.Bucket,
+			Prefix:    config.S3.Prefix,
+			AccessKey: config.S3.AccessKey,
+			SecretKey: config.S3.SecretKey,
+		}, &http.Client{Timeout: StoreTimeout})
 	}
-	if config.Server.EnableViewLatest {
-		logInfo("Enable view: Latest")
-		handler.Handle(fugl.SERVER_LATEST_PATH, &LatestHandler{state: state})
+	return fugl.OpenStore(config.Store)
+}
+
+/* Verifies stored proofs (oldest first) and makes the last the latest proof,
+ * following announced key rotations
+ */
+
+func (state *ServerState) follow(proofs []string) error {
+	for _, proof := range proofs {
+		opened, err := fugl.VerifyProof(state.canaryVerifier, proof)
+		if err != nil {
+			return err
+		}
+		canary := opened.Canary
+		if canary.Rotation != nil {
+			logInfo(state.tagged("Following key rotation:"), canary.Rotation.Retire, "->", canary.Rotation.Next)
+			state.canaryVerifier, err = state.canaryVerifier.Rotate(canary.Rotation)
+			if err != nil {
+				return err
+			}
+			state.canaryKeyArmor, err = state.canaryVerifier.PublicKeys()
+			if err != nil {
+				return err
+			}
+		}
+		state.latestProof = proof
+		state.latestCanary = canary
+		state.latestSigners = opened.Signers
+		state.latestToken = nil
+		state.history.add(proof, canary)
+	}
+	if timestamps, ok := state.store.(fugl.TimestampStore); ok && state.latestProof != "" {
+		token, err := timestamps.Timestamp(fugl.HashString(state.latestProof))
+		if err != nil {
+			return err
+		}
+		state.latestToken = token
+	}
+	return nil
+}
+
+/* Follows proofs accepted by other servers sharing the store
+ */
+
+func (state *ServerState) refresh() error {
+	var from time.Time
+	if state.latestCanary != nil {
+		from = state.latestCanary.Expiry.Time()
 	}
-	if config.Server.EnableViewGetKey {
-		logInfo("Enable view: GetKey")
-		handler.Handle(fugl.SERVER_GETKEY_PATH, &GetKeyHandler{state: state})
+	proofs, err := state.store.List(from, time.Time{})
+	if err != nil {
+		return err
+	}
+	var newer []string
+	for _, proof := range proofs {
+		if proof != state.latestProof {
+			newer = append(newer, proof)
+		}
+	}
+	return state.follow(newer)
+}
+
+func buildHandler(config Config, hosted []*HostedCanary) http.Handler {
+	handler := http.NewServeMux()
+	for _, h := range hosted {
+		logInfo("Loading canary:", describeHosted(h.name))
+		h.state = createState(h.name, h.config)
+		if config.Server.EnableViewSubmit {
+			logInfo("Enable view: Submit", h.path(fugl.SERVER_SUBMIT_PATH))
+			handler.Handle(h.path(fugl.SERVER_SUBMIT_PATH), &SubmitHandler{state: h.state})
+		}
+		if config.Server.EnableViewLatest {
+			logInfo("Enable view: Latest", h.path(fugl.SERVER_LATEST_PATH))
+			handler.Handle(h.path(fugl.SERVER_LATEST_PATH), &LatestHandler{state: h.state})
+		}
+		if config.Server.EnableViewGetKey {
+			logInfo("Enable view: GetKey", h.path(fugl.SERVER_GETKEY_PATH))
+			handler.Handle(h.path(fugl.SERVER_GETKEY_PATH), &GetKeyHandler{state: h.state})
+		}
+		if config.Server.EnableViewHistory {
+			logInfo("Enable view: History", h.path(fugl.SERVER_HISTORY_PATH), h.path(fugl.SERVER_PROOF_PATH))
+			handler.Handle(h.path(fugl.SERVER_HISTORY_PATH), &HistoryHandler{state: h.state})
+			handler.Handle(h.path(fugl.SERVER_PROOF_PATH), &ProofHandler{state: h.state, prefix: h.path(fugl.SERVER_PROOF_PATH)})
+		}
 	}
-	return handler, state
+	if config.Server.EnableViewIndex && len(config.Canaries) > 0 {
+		logInfo("Enable view: Index", fugl.SERVER_CANARIES_PATH)
+		handler.Handle(fugl.SERVER_CANARIES_PATH, &IndexHandler{hosted: hosted})
+	}
+	return handler
 }
 
 func main() {
 	// initalize logger
+	flag.Parse()
 	config, err := loadConfig()
 	if err != nil {
 		logFatal("Unable to load config")
 	}
 	initLogging(config)
+	if *FlagFsck {
+		runFsck(config)
+		return
+	}
 
-	// build handler and server state
-	handler, state := buildHandler(config)
-	go actionRunner(config.Canary.OnFailure, state)
+	// build handler and server state of every canary
+	hosted := hostedCanaries(config)
+	handler := buildHandler(config, hosted)
+	for _, h := range hosted {
+		go actionRunner(h.config.OnFailure, h.state)
+		go retentionRunner(h.config.Retention, h.state)
+		go refreshRunner(refreshInterval(h.config), h.state)
+	}
 
 	// build server
 	bind := fmt.Sprintf(
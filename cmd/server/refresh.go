@@ -0,0 +1,39 @@
+package main
+
+import (
+	"time"
+)
+
+/* Periodically reads proofs accepted by other servers sharing the store,
+ * allowing replicas which take no submissions to serve the latest canary
+ */
+
+const RefreshDefaultInterval = 30 // seconds, for stores shared by default ("s3")
+
+func refreshInterval(config ConfigCanary) time.Duration {
+	interval := config.Refresh
+	if interval == 0 && config.Store == StoreS3 {
+		interval = RefreshDefaultInterval
+	}
+	return time.Duration(interval) * time.Second
+}
+
+func refreshRunner(interval time.Duration, state *ServerState) {
+	// check if feature enabled
+	if interval <= 0 {
+		return
+	}
+	logInfo(state.tagged("Refreshing from store every:"), interval)
+	for range time.Tick(interval) {
+		state.reload()
+	}
+}
+
+// takes the write lock and follows proofs accepted by other servers
+func (state *ServerState) reload() {
+	state.canaryLock.Lock()
+	defer state.canaryLock.Unlock()
+	if err := state.refresh(); err != nil {
+		logError(state.tagged("Failed to refresh from store:"), err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"github.com/rot256/fugl"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// replica of a canary stored in dir
+func newReplica(t *testing.T, dir string, verifier fugl.Verifier) *ServerState {
+	store, err := fugl.NewDirectoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &ServerState{store: store, canaryVerifier: verifier, configVerifier: verifier}
+	proofs, err := store.List(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.follow(proofs); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func submit(t *testing.T, state *ServerState, proof string) {
+	form := url.Values{fugl.SERVER_SUBMIT_FIELD_NAME: {proof}}
+	r := httptest.NewRequest(http.MethodPost, fugl.SERVER_SUBMIT_PATH, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	(&SubmitHandler{state: state}).ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected proof to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func latest(state *ServerState) string {
+	w := httptest.NewRecorder()
+	(&LatestHandler{state: state}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, fugl.SERVER_LATEST_PATH, nil))
+	return w.Body.String()
+}
+
+func TestRefresh__Replicas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fugl-replicas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := fugl.Ed25519Signer{Keys: []ed25519.PrivateKey{private}}
+	verifier := fugl.Ed25519Verifier{Keys: []ed25519.PublicKey{public}}
+
+	// canaries expiring one and three hours from now
+	now := time.Now().Add(-time.Minute)
+	var proofs []string
+	for i, expiry := range []time.Duration{time.Hour, 3 * time.Hour} {
+		canary := fugl.Canary{
+			Version:  fugl.CanaryVersion,
+			Author:   "John Doe",
+			Creation: fugl.CanaryTime(now.Add(time.Duration(i) * time.Second)),
+			Expiry:   fugl.CanaryTime(now.Add(expiry)),
+			Promises: []fugl.Promise{},
+			Nonce:    fugl.GetRandStr(fugl.CanaryNonceSize),
+		}
+		if i > 0 {
+			canary.Previous = fugl.HashString(proofs[i-1])
+		}
+		proof, err := fugl.SealProof(signer, canary, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		proofs = append(proofs, proof)
+	}
+
+	// only the submitter takes submissions
+	submitter := newReplica(t, dir, verifier)
+	submit(t, submitter, proofs[0])
+	replica := newReplica(t, dir, verifier)
+	if latest(replica) != proofs[0] {
+		t.Fatal("expected replica to load the stored proof")
+	}
+	submit(t, submitter, proofs[1])
+	if latest(replica) != proofs[0] {
+		t.Fatal("expected replica to serve the old proof before refreshing")
+	}
+
+	// the failure action deadline reads the store first
+	deadline := replica.deadline()
+	if !deadline.Equal(submitter.latestCanary.Expiry.Time()) {
+		t.Fatalf("expected deadline of the newest canary, got %v", deadline)
+	}
+	if latest(replica) != proofs[1] {
+		t.Fatal("expected replica to serve the newest proof after refreshing")
+	}
+	page := replica.history.page(time.Time{}, HistoryDefaultLimit)
+	if len(page.Proofs) != 2 || page.Proofs[1].Hash != fugl.HashString(proofs[1]) {
+		t.Fatalf("expected both proofs in the replica history, got %v", page.Proofs)
+	}
+
+	// refreshing without new proofs keeps the latest proof
+	replica.reload()
+	if latest(replica) != proofs[1] {
+		t.Fatal("expected replica to keep the newest proof")
+	}
+
+	if interval := refreshInterval(ConfigCanary{Store: StoreS3}); interval != RefreshDefaultInterval*time.Second {
+		t.Fatalf("unexpected default interval for s3: %v", interval)
+	}
+	if interval := refreshInterval(ConfigCanary{Store: dir}); interval != 0 {
+		t.Fatalf("expected refreshing disabled by default, got %v", interval)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/rot256/fugl"
+	"time"
+)
+
+/* Periodically moves proofs not retained by the policy into archives
+ */
+
+const RetentionInterval = 24 * time.Hour
+
+func retentionPolicy(config ConfigRetention) fugl.RetentionPolicy {
+	return fugl.RetentionPolicy{
+		KeepLast:    config.KeepLast,
+		KeepWithin:  time.Duration(config.KeepDays) * 24 * time.Hour,
+		KeepMonthly: config.KeepMonthly,
+	}
+}
+
+func loadArchives(config ConfigRetention) []*fugl.Archive {
+	if config.ArchiveDir == "" {
+		return nil
+	}
+	archives, err := fugl.LoadArchives(config.ArchiveDir)
+	if err != nil {
+		logFatal("Failed to load archives:", err)
+	}
+	return archives
+}
+
+func retentionRunner(config ConfigRetention, state *ServerState) {
+	// check if feature enabled
+	policy := retentionPolicy(config)
+	if !policy.Enabled() {
+		return
+	}
+	logInfo(state.tagged("Retention policy:"), config.KeepLast, "proofs,", config.KeepDays, "days, monthly:", config.KeepMonthly)
+
+	deletes, ok := state.store.(fugl.DeleteStore)
+	if !ok {
+		logError(state.tagged("Failed to archive proofs:"), "Store does not support removing proofs")
+		return
+	}
+	for ticker := time.NewTicker(RetentionInterval); ; <-ticker.C {
+		// verifying the proofs and building the archive only reads the store
+		state.canaryLock.RLock()
+		pending, err := fugl.PrepareArchive(state.store, state.configVerifier, policy, time.Now())
+		state.canaryLock.RUnlock()
+		if err != nil {
+			logError(state.tagged("Failed to archive proofs:"), err)
+			continue
+		}
+		if pending == nil {
+			continue
+		}
+		name, err := pending.Write(config.ArchiveDir)
+		if err != nil {
+			logError(state.tagged("Failed to write archive:"), err)
+			continue
+		}
+
+		// remove the archived proofs
+		state.canaryLock.Lock()
+		count, err := pending.Remove(deletes)
+		state.forgetArchived(pending.Manifest.Proofs[:count])
+		state.canaryLock.Unlock()
+		if err != nil {
+			logError(state.tagged("Failed to remove archived proofs:"), err)
+			continue
+		}
+		logInfo(state.tagged("Archived"), count, "proofs to:", name)
+	}
+}
@@ -0,0 +1,107 @@
+package fugl
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+/* Signs by piping the message to an external command,
+ * e.g. "gpg --clearsign --local-user 'Jane Doe <jane@example.com>'" for keys held by gpg-agent or a HSM.
+ *
+ * The output of the command is the proof,
+ * callers should verify it (e.g. using OpenProof) before use.
+ */
+
+type CommandSigner struct {
+	Command []string // program and arguments
+}
+
+// the command is split into arguments like a shell does (see SplitCommand)
+func NewCommandSigner(command string) (CommandSigner, error) {
+	parts, err := SplitCommand(command)
+	if err != nil {
+		return CommandSigner{}, err
+	}
+	if len(parts) == 0 {
+		return CommandSigner{}, errors.New("Empty signing command")
+	}
+	return CommandSigner{Command: parts}, nil
+}
+
+/* Splits a command into arguments following the quoting rules of a POSIX shell:
+ * arguments are separated by whitespace, single quotes preserve everything,
+ * within double quotes a backslash escapes '"', '\\', '$' and '`',
+ * outside quotes a backslash escapes any character.
+ * No expansion (variables, globs) is performed.
+ */
+
+func SplitCommand(command string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case c == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("Unterminated single quote in command")
+			}
+			arg.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case c == '"':
+			i++
+			for ; i < len(command) && command[i] != '"'; i++ {
+				if command[i] == '\\' && i+1 < len(command) && strings.IndexByte("\"\\$`", command[i+1]) >= 0 {
+					i++
+				}
+				arg.WriteByte(command[i])
+			}
+			if i == len(command) {
+				return nil, errors.New("Unterminated double quote in command")
+			}
+			inArg = true
+		case c == '\\':
+			if i+1 == len(command) {
+				return nil, errors.New("Trailing backslash in command")
+			}
+			i++
+			arg.WriteByte(command[i])
+			inArg = true
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+func (s CommandSigner) Sign(message []byte) (string, error) {
+	if len(s.Command) == 0 {
+		return "", errors.New("Empty signing command")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(s.Command[0], s.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(message)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.New("Signing command failed: " + err.Error() + ": " + strings.TrimSpace(stderr.String()))
+	}
+	if len(out) == 0 {
+		return "", errors.New("Signing command produced no output")
+	}
+	return string(out), nil
+}
@@ -0,0 +1,56 @@
+package fugl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommand__Sign(t *testing.T) {
+	// cat produces the message unsigned
+	signer, err := NewCommandSigner("cat")
+	if err != nil {
+		t.Fatalf("error creating command signer, err=%v", err)
+	}
+	proof, err := signer.Sign([]byte("this is a test message"))
+	if err != nil {
+		t.Fatalf("error running signing command, err=%v", err)
+	}
+	if proof != "this is a test message" {
+		t.Fatalf("unexpected output of signing command: %s", proof)
+	}
+
+	signer, _ = NewCommandSigner("false")
+	if _, err := signer.Sign([]byte("this is a test message")); err == nil {
+		t.Fatal("expected an error when signing command fails")
+	}
+	if _, err := NewCommandSigner(" "); err == nil {
+		t.Fatal("expected an error creating empty signing command")
+	}
+}
+
+func TestCommand__Split(t *testing.T) {
+	cases := []struct {
+		command string
+		args    []string
+	}{
+		{"gpg --clearsign", []string{"gpg", "--clearsign"}},
+		{`gpg --local-user "Jane Doe <j@x>"`, []string{"gpg", "--local-user", "Jane Doe <j@x>"}},
+		{`gpg --local-user 'Jane Doe' -a`, []string{"gpg", "--local-user", "Jane Doe", "-a"}},
+		{`sign "a \"b\" \$c" 'd\e' f\ g ""`, []string{"sign", `a "b" $c`, `d\e`, "f g", ""}},
+		{"  sign\t--x  ", []string{"sign", "--x"}},
+	}
+	for _, test := range cases {
+		args, err := SplitCommand(test.command)
+		if err != nil {
+			t.Fatalf("error splitting %q, err=%v", test.command, err)
+		}
+		if strings.Join(args, "|") != strings.Join(test.args, "|") || len(args) != len(test.args) {
+			t.Fatalf("splitting %q: expected %q, got %q", test.command, test.args, args)
+		}
+	}
+	for _, command := range []string{`gpg "unterminated`, `gpg 'unterminated`, `gpg \`} {
+		if _, err := SplitCommand(command); err == nil {
+			t.Fatalf("expected an error splitting %q", command)
+		}
+	}
+}
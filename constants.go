@@ -6,5 +6,10 @@ const (
 	SERVER_STATUS_PATH       = "/status"
 	SERVER_LATEST_PATH       = "/latest"
 	SERVER_GETKEY_PATH       = "/getkey"
+	SERVER_HISTORY_PATH      = "/history"
+	SERVER_PROOF_PATH        = "/proof/"          // followed by the hash of the proof
+	SERVER_CANARIES_PATH     = "/c/"              // index of hosted canaries, each served under /c/<name>
+	SERVER_SIGNERS_HEADER    = "X-Fugl-Signers"   // fingerprints of keys signing the proof
+	SERVER_TIMESTAMP_HEADER  = "X-Fugl-Timestamp" // base64 encoded RFC 3161 timestamp token over the proof
 	CANARY_SEPERATOR         = "# Metadata"
 )
@@ -0,0 +1,166 @@
+package fugl
+
+import (
+	"fmt"
+	"time"
+)
+
+/* Computes the changes between two consecutive canaries,
+ * allowing monitors to notify users of e.g. removed promises
+ */
+
+// relative deviation of the interval between creations tolerated before reporting a cadence change
+const CadenceTolerance = 0.1
+
+type ChangeKind int
+
+const (
+	ChangePromiseRemoved    ChangeKind = iota // promise no longer present
+	ChangePromiseAdded                        // new promise
+	ChangePromiseReworded                     // promise text changed (same identifier)
+	ChangeFinal                               // canary became final
+	ChangeAuthor                              // author changed
+	ChangeValidityShortened                   // validity window (expiry - creation) shorter than the old
+	ChangeCadence                             // interval between creations changed (see DiffChain)
+	ChangeKeyRotation                         // signing key rotation announced
+)
+
+type Change struct {
+	Kind    ChangeKind
+	Promise *Promise // promise concerned (for promise changes)
+	Old     string   // old value (if applicable)
+	New     string   // new value (if applicable)
+}
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangePromiseRemoved:
+		return "promise removed"
+	case ChangePromiseAdded:
+		return "promise added"
+	case ChangePromiseReworded:
+		return "promise reworded"
+	case ChangeFinal:
+		return "became final"
+	case ChangeAuthor:
+		return "author changed"
+	case ChangeValidityShortened:
+		return "validity shortened"
+	case ChangeCadence:
+		return "cadence changed"
+	case ChangeKeyRotation:
+		return "key rotation"
+	}
+	return fmt.Sprintf("unknown change (%d)", int(k))
+}
+
+func (c Change) String() string {
+	if c.Promise != nil {
+		return fmt.Sprintf("%s: %s", c.Kind, c.Promise.ID)
+	}
+	if c.Old != "" || c.New != "" {
+		return fmt.Sprintf("%s: '%s' -> '%s'", c.Kind, c.Old, c.New)
+	}
+	return c.Kind.String()
+}
+
+func Diff(old *Canary, new *Canary) []Change {
+	var changes []Change
+	if old == nil || new == nil {
+		return changes
+	}
+
+	// compare promises
+	for _, match := range MatchPromises(old.Promises, new.Promises) {
+		switch {
+		case match.New == nil:
+			changes = append(changes, Change{
+				Kind:    ChangePromiseRemoved,
+				Promise: match.Old,
+				Old:     match.Old.Text,
+			})
+		case match.Old == nil:
+			changes = append(changes, Change{
+				Kind:    ChangePromiseAdded,
+				Promise: match.New,
+				New:     match.New.Text,
+			})
+		case match.Old.Text != match.New.Text:
+			changes = append(changes, Change{
+				Kind:    ChangePromiseReworded,
+				Promise: match.New,
+				Old:     match.Old.Text,
+				New:     match.New.Text,
+			})
+		}
+	}
+
+	// compare remaining fields
+	if new.Final && !old.Final {
+		changes = append(changes, Change{Kind: ChangeFinal})
+	}
+	if new.Author != old.Author {
+		changes = append(changes, Change{
+			Kind: ChangeAuthor,
+			Old:  old.Author,
+			New:  new.Author,
+		})
+	}
+	oldWindow := old.Expiry.Time().Sub(old.Creation.Time())
+	newWindow := new.Expiry.Time().Sub(new.Creation.Time())
+	if newWindow < oldWindow {
+		changes = append(changes, Change{
+			Kind: ChangeValidityShortened,
+			Old:  oldWindow.String(),
+			New:  newWindow.String(),
+		})
+	}
+	if new.Rotation != nil {
+		changes = append(changes, Change{
+			Kind: ChangeKeyRotation,
+			Old:  new.Rotation.Retire,
+			New:  new.Rotation.Next,
+		})
+	}
+	return changes
+}
+
+/* Computes the changes along a chain of canaries (oldest first),
+ * the i'th element lists the changes between chain[i] and chain[i+1].
+ *
+ * Besides the changes reported by Diff,
+ * a cadence change is reported when the interval between two creations
+ * deviates from the preceding interval by more than CadenceTolerance.
+ */
+
+func DiffChain(chain []*Canary) [][]Change {
+	var changes [][]Change
+	var interval time.Duration
+	for i := 0; i+1 < len(chain); i++ {
+		old, new := chain[i], chain[i+1]
+		diff := Diff(old, new)
+		if old != nil && new != nil {
+			next := new.Creation.Time().Sub(old.Creation.Time())
+			if interval > 0 && cadenceChanged(interval, next) {
+				diff = append(diff, Change{
+					Kind: ChangeCadence,
+					Old:  interval.String(),
+					New:  next.String(),
+				})
+			}
+			interval = next
+		} else {
+			interval = 0
+		}
+		changes = append(changes, diff)
+	}
+	return changes
+}
+
+func cadenceChanged(old time.Duration, new time.Duration) bool {
+	deviation := new - old
+	if deviation < 0 {
+		deviation = -deviation
+	}
+	return float64(deviation) > CadenceTolerance*float64(old)
+}
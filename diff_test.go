@@ -0,0 +1,127 @@
+package fugl
+
+import (
+	"testing"
+	"time"
+)
+
+const (
+	testWeek   = 7 * 24 * time.Hour
+	testWindow = 30 * 24 * time.Hour
+)
+
+// canary created at creation and valid for window
+func testCanary(creation time.Time, window time.Duration) *Canary {
+	return &Canary{
+		Author:   "John Doe",
+		Creation: CanaryTime(creation),
+		Expiry:   CanaryTime(creation.Add(window)),
+		Promises: []Promise{{ID: "kept", Text: "kept"}},
+	}
+}
+
+func countChanges(changes []Change) map[ChangeKind]int {
+	found := make(map[ChangeKind]int)
+	for _, change := range changes {
+		found[change.Kind]++
+	}
+	return found
+}
+
+func TestDiff__Changes(t *testing.T) {
+	start := time.Now().Add(-4 * testWeek)
+	old := testCanary(start, testWindow)
+	old.Promises = []Promise{
+		{ID: "kept", Text: "kept"},
+		{ID: "reworded", Text: "original"},
+		{ID: "removed", Text: "removed"},
+	}
+
+	// renewed a week later (before the old canary expires), valid for only two weeks
+	new := testCanary(start.Add(testWeek), 2*testWeek)
+	new.Author = "Jane Doe"
+	new.Promises = []Promise{
+		{ID: "kept", Text: "kept"},
+		{ID: "reworded", Text: "reworded"},
+		{ID: "added", Text: "added"},
+	}
+	new.Final = true
+	if !new.Expiry.Time().Before(old.Expiry.Time()) {
+		t.Fatal("expected the renewed canary to expire first")
+	}
+
+	found := countChanges(Diff(old, new))
+	expected := []ChangeKind{
+		ChangePromiseRemoved,
+		ChangePromiseAdded,
+		ChangePromiseReworded,
+		ChangeFinal,
+		ChangeAuthor,
+		ChangeValidityShortened,
+	}
+	for _, kind := range expected {
+		if found[kind] != 1 {
+			t.Fatalf("expected one '%s' change, got %d", kind, found[kind])
+		}
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("unexpected changes: %v", found)
+	}
+}
+
+func TestDiff__NoChanges(t *testing.T) {
+	start := time.Now().Add(-4 * testWeek)
+	old := testCanary(start, testWindow)
+	new := testCanary(start.Add(testWeek), testWindow)
+
+	changes := Diff(old, new)
+	if len(changes) != 0 {
+		t.Fatalf("expected no changes, got %v", changes)
+	}
+	if len(Diff(nil, new)) != 0 {
+		t.Fatal("expected no changes without old canary")
+	}
+
+	// a longer window is not reported
+	longer := testCanary(start.Add(testWeek), 2*testWindow)
+	if changes := Diff(old, longer); len(changes) != 0 {
+		t.Fatalf("expected no changes for a longer window, got %v", changes)
+	}
+}
+
+func TestDiff__Cadence(t *testing.T) {
+	start := time.Now().Add(-10 * testWeek)
+	creations := []time.Duration{
+		0,
+		testWeek,
+		2*testWeek + time.Hour, // within the tolerance
+		3 * testWeek,
+		5 * testWeek, // renewed after two weeks
+		7 * testWeek,
+	}
+	var chain []*Canary
+	for _, offset := range creations {
+		chain = append(chain, testCanary(start.Add(offset), testWindow))
+	}
+
+	changes := DiffChain(chain)
+	if len(changes) != len(chain)-1 {
+		t.Fatalf("expected %d diffs, got %d", len(chain)-1, len(changes))
+	}
+	for i, diff := range changes {
+		found := countChanges(diff)
+		expected := 0
+		if i == 3 {
+			expected = 1
+		}
+		if found[ChangeCadence] != expected || len(diff) != expected {
+			t.Fatalf("diff %d: expected %d cadence changes, got %v", i, expected, diff)
+		}
+	}
+	if changes[3][0].Old != (testWeek-time.Hour).String() || changes[3][0].New != (2*testWeek).String() {
+		t.Fatalf("unexpected cadence change: %s", changes[3][0])
+	}
+	if len(DiffChain(chain[:1])) != 0 {
+		t.Fatal("expected no diffs for a single canary")
+	}
+}
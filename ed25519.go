@@ -0,0 +1,369 @@
+package fugl
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"strings"
+)
+
+/* Ed25519 signature backend, using a format specific to fugl
+ *
+ * Keys are stored PEM encoded and the signatures are appended to the message
+ * in a PEM block, each signature prefixed by the SHA-256 fingerprint of the public key:
+ *
+ * <message>
+ * -----BEGIN FUGL ED25519 SIGNATURE-----
+ * <base64(fingerprint || signature || ...)>
+ * -----END FUGL ED25519 SIGNATURE-----
+ *
+ * Private keys are encrypted under a passphrase (scrypt and NaCl secretbox):
+ *
+ * -----BEGIN FUGL ED25519 ENCRYPTED PRIVATE KEY-----
+ * <base64(salt || nonce || secretbox(seed))>
+ * -----END FUGL ED25519 ENCRYPTED PRIVATE KEY-----
+ *
+ * Unencrypted private keys (FUGL ED25519 PRIVATE KEY) contain the seed.
+ */
+
+const (
+	Ed25519PublicKeyType           = "FUGL ED25519 PUBLIC KEY"
+	Ed25519PrivateKeyType          = "FUGL ED25519 PRIVATE KEY"
+	Ed25519EncryptedPrivateKeyType = "FUGL ED25519 ENCRYPTED PRIVATE KEY"
+	Ed25519SignatureType           = "FUGL ED25519 SIGNATURE"
+	ed25519EntrySize               = sha256.Size + ed25519.SignatureSize
+	ed25519SaltSize                = 32
+	ed25519NonceSize               = 24
+	ed25519EncryptedSize           = ed25519SaltSize + ed25519NonceSize + secretbox.Overhead + ed25519.SeedSize
+	ed25519ScryptN                 = 1 << 15
+	ed25519ScryptR                 = 8
+	ed25519ScryptP                 = 1
+)
+
+var ErrEd25519PassphraseMissing = errors.New("Ed25519 private key is encrypted, passphrase required")
+
+func Ed25519Fingerprint(key ed25519.PublicKey) string {
+	hash := sha256.Sum256(key)
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
+
+/* Generates a key pair, encrypting the private key under the passphrase
+ * (the private key is stored unencrypted if the passphrase is empty)
+ */
+
+func Ed25519GenerateKey(passphrase []byte) (string, string, error) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return "", "", err
+	}
+	pub := pem.EncodeToMemory(&pem.Block{Type: Ed25519PublicKeyType, Bytes: public})
+	block := &pem.Block{Type: Ed25519PrivateKeyType, Bytes: private.Seed()}
+	if len(passphrase) > 0 {
+		block, err = ed25519EncryptSeed(private.Seed(), passphrase)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return string(pub), string(pem.EncodeToMemory(block)), nil
+}
+
+func ed25519SecretKey(passphrase []byte, salt []byte) (*[32]byte, error) {
+	derived, err := scrypt.Key(passphrase, salt, ed25519ScryptN, ed25519ScryptR, ed25519ScryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	copy(key[:], derived)
+	return &key, nil
+}
+
+func ed25519EncryptSeed(seed []byte, passphrase []byte) (*pem.Block, error) {
+	var nonce [ed25519NonceSize]byte
+	salt := make([]byte, ed25519SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	key, err := ed25519SecretKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := append(salt, nonce[:]...)
+	encrypted = secretbox.Seal(encrypted, seed, &nonce, key)
+	return &pem.Block{Type: Ed25519EncryptedPrivateKeyType, Bytes: encrypted}, nil
+}
+
+func ed25519DecryptSeed(encrypted []byte, passphrase []byte) ([]byte, error) {
+	if len(encrypted) != ed25519EncryptedSize {
+		return nil, errors.New("Invalid Ed25519 private key size")
+	}
+	var nonce [ed25519NonceSize]byte
+	salt := encrypted[:ed25519SaltSize]
+	copy(nonce[:], encrypted[ed25519SaltSize:])
+	key, err := ed25519SecretKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	seed, ok := secretbox.Open(nil, encrypted[ed25519SaltSize+ed25519NonceSize:], &nonce, key)
+	if !ok {
+		return nil, errors.New("Failed to decrypt Ed25519 private key")
+	}
+	return seed, nil
+}
+
+func Ed25519ArmorPublicKey(key ed25519.PublicKey) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: Ed25519PublicKeyType, Bytes: key}))
+}
+
+/* Loads a private key, decrypting it using the passphrase.
+ * Returns ErrEd25519PassphraseMissing for encrypted keys if the passphrase is nil.
+ */
+
+func Ed25519LoadPrivateKey(key []byte, passphrase []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, errors.New("Not a Ed25519 private key")
+	}
+	seed := block.Bytes
+	switch block.Type {
+	case Ed25519PrivateKeyType:
+	case Ed25519EncryptedPrivateKeyType:
+		if passphrase == nil {
+			return nil, ErrEd25519PassphraseMissing
+		}
+		var err error
+		seed, err = ed25519DecryptSeed(block.Bytes, passphrase)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("Not a Ed25519 private key")
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("Invalid Ed25519 private key size")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func Ed25519LoadPublicKey(key []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(key)
+	if block == nil || block.Type != Ed25519PublicKeyType {
+		return nil, errors.New("Not a Ed25519 public key")
+	}
+	if len(block.Bytes) != ed25519.PublicKeySize {
+		return nil, errors.New("Invalid Ed25519 public key size")
+	}
+	return ed25519.PublicKey(block.Bytes), nil
+}
+
+func Ed25519LoadKeyring(keys []byte) ([]ed25519.PublicKey, error) {
+	var keyring []ed25519.PublicKey
+	for {
+		block, rest := pem.Decode(keys)
+		if block == nil {
+			break
+		}
+		if block.Type != Ed25519PublicKeyType || len(block.Bytes) != ed25519.PublicKeySize {
+			return nil, errors.New("Invalid Ed25519 public key in keyring")
+		}
+		keyring = append(keyring, ed25519.PublicKey(block.Bytes))
+		keys = rest
+	}
+	if len(keyring) == 0 {
+		return nil, errors.New("No Ed25519 public keys found")
+	}
+	return keyring, nil
+}
+
+func Ed25519Sign(keys []ed25519.PrivateKey, message []byte) (string, error) {
+	if bytes.Contains(message, []byte("-----BEGIN "+Ed25519SignatureType)) {
+		return "", errors.New("Message contains signature marker")
+	}
+	entries, err := ed25519Entries(keys, message, nil)
+	if err != nil {
+		return "", err
+	}
+	sig := pem.EncodeToMemory(&pem.Block{Type: Ed25519SignatureType, Bytes: entries})
+	return string(message) + "\n" + string(sig), nil
+}
+
+// appends a signature by every key to the existing entries of the signature block
+func ed25519Entries(keys []ed25519.PrivateKey, message []byte, existing []byte) ([]byte, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no private keys supplied")
+	}
+	entries := append([]byte{}, existing...)
+	for _, key := range keys {
+		if len(key) != ed25519.PrivateKeySize {
+			return nil, errors.New("invalid private key")
+		}
+		hash := sha256.Sum256(key.Public().(ed25519.PublicKey))
+		for signed := existing; len(signed) >= ed25519EntrySize; signed = signed[ed25519EntrySize:] {
+			if bytes.Equal(signed[:sha256.Size], hash[:]) {
+				return nil, errors.New("Proof already signed by: " + Ed25519Fingerprint(key.Public().(ed25519.PublicKey)))
+			}
+		}
+		entries = append(entries, hash[:]...)
+		entries = append(entries, ed25519.Sign(key, message)...)
+	}
+	return entries, nil
+}
+
+/* Adds a signature by every key to the signature block of the proof,
+ * keeping the existing signatures (e.g. of officers signing separately)
+ */
+
+func Ed25519Cosign(keys []ed25519.PrivateKey, proof []byte) (string, error) {
+	message, block, err := ed25519SplitProof(proof)
+	if err != nil {
+		return "", err
+	}
+	entries, err := ed25519Entries(keys, message, block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	sig := pem.EncodeToMemory(&pem.Block{Type: Ed25519SignatureType, Bytes: entries})
+	return string(message) + "\n" + string(sig), nil
+}
+
+// splits the proof into the message and signature block
+func ed25519SplitProof(proof []byte) ([]byte, *pem.Block, error) {
+	marker := []byte("\n-----BEGIN " + Ed25519SignatureType + "-----")
+	index := bytes.LastIndex(proof, marker)
+	if index < 0 {
+		return nil, nil, errors.New("Unable to find signature block")
+	}
+	block, rest := pem.Decode(proof[index+1:])
+	if block == nil || block.Type != Ed25519SignatureType {
+		return nil, nil, errors.New("Unable to read signature block")
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return nil, nil, errors.New("Proof contains junk")
+	}
+	if len(block.Bytes) == 0 || len(block.Bytes)%ed25519EntrySize != 0 {
+		return nil, nil, errors.New("Invalid signature block size")
+	}
+	return proof[:index], block, nil
+}
+
+func Ed25519Verify(keys []ed25519.PublicKey, threshold int, proof []byte) ([]byte, []string, error) {
+	if len(keys) == 0 {
+		return nil, nil, errors.New("invalid public key")
+	}
+	if threshold < 1 || threshold > len(keys) {
+		return nil, nil, errors.New("Invalid signature threshold")
+	}
+
+	// split message and signature block
+	message, block, err := ed25519SplitProof(proof)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// verify signatures one at a time
+	var signers []string
+	seen := make(map[string]bool)
+	for entries := block.Bytes; len(entries) > 0; entries = entries[ed25519EntrySize:] {
+		fingerprint := strings.ToUpper(hex.EncodeToString(entries[:sha256.Size]))
+		signature := entries[sha256.Size:ed25519EntrySize]
+		var signer ed25519.PublicKey
+		for _, key := range keys {
+			if Ed25519Fingerprint(key) == fingerprint {
+				signer = key
+			}
+		}
+		if signer == nil || !ed25519.Verify(signer, message, signature) {
+			return nil, nil, errors.New("Invalid signature")
+		}
+		if !seen[fingerprint] {
+			seen[fingerprint] = true
+			signers = append(signers, fingerprint)
+		}
+	}
+	if len(signers) < threshold {
+		return nil, nil, errors.New(fmt.Sprintf("Signed by %d keys, %d required", len(signers), threshold))
+	}
+	return message, signers, nil
+}
+
+func Ed25519KeyRotation(retire ed25519.PublicKey, next ed25519.PublicKey) *KeyRotation {
+	return &KeyRotation{
+		Retire: Ed25519Fingerprint(retire),
+		Next:   Ed25519Fingerprint(next),
+		Key:    Ed25519ArmorPublicKey(next),
+	}
+}
+
+type Ed25519Signer struct {
+	Keys []ed25519.PrivateKey // private keys, each producing a signature
+}
+
+type Ed25519Verifier struct {
+	Keys      []ed25519.PublicKey // public keys of signers
+	Threshold int                 // number of signatures required (0 is treated as 1)
+}
+
+func (s Ed25519Signer) Sign(message []byte) (string, error) {
+	return Ed25519Sign(s.Keys, message)
+}
+
+func (s Ed25519Signer) Cosign(proof []byte) (string, error) {
+	return Ed25519Cosign(s.Keys, proof)
+}
+
+func (v Ed25519Verifier) Verify(proof []byte) ([]byte, []string, error) {
+	threshold := v.Threshold
+	if threshold == 0 {
+		threshold = 1
+	}
+	return Ed25519Verify(v.Keys, threshold, proof)
+}
+
+func (v Ed25519Verifier) Rotate(rotation *KeyRotation) (Verifier, error) {
+	if rotation == nil {
+		return v, nil
+	}
+	next, err := Ed25519LoadPublicKey([]byte(rotation.Key))
+	if err != nil {
+		return nil, errors.New("Unable to parse next key: " + err.Error())
+	}
+	if !strings.EqualFold(Ed25519Fingerprint(next), rotation.Next) {
+		return nil, errors.New("Next key does not match fingerprint")
+	}
+
+	// replace retired key
+	retired := false
+	rotated := make([]ed25519.PublicKey, 0, len(v.Keys))
+	for _, key := range v.Keys {
+		fingerprint := Ed25519Fingerprint(key)
+		if strings.EqualFold(fingerprint, rotation.Next) {
+			return nil, errors.New("Next key is already in use")
+		}
+		if strings.EqualFold(fingerprint, rotation.Retire) {
+			retired = true
+			continue
+		}
+		rotated = append(rotated, key)
+	}
+	if !retired {
+		return nil, errors.New("Retired key is not in use")
+	}
+	return Ed25519Verifier{Keys: append(rotated, next), Threshold: v.Threshold}, nil
+}
+
+func (v Ed25519Verifier) PublicKeys() (string, error) {
+	var armored string
+	for _, key := range v.Keys {
+		armored += Ed25519ArmorPublicKey(key)
+	}
+	return armored, nil
+}
@@ -0,0 +1,140 @@
+package fugl
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+)
+
+func newEd25519Keys(t *testing.T, n int) ([]ed25519.PublicKey, []ed25519.PrivateKey) {
+	var pubs []ed25519.PublicKey
+	var privs []ed25519.PrivateKey
+	for i := 0; i < n; i++ {
+		public, private, err := Ed25519GenerateKey(nil)
+		if err != nil {
+			t.Fatalf("error creating ed25519 keys, err=%v", err)
+		}
+		pub, err := Ed25519LoadPublicKey([]byte(public))
+		if err != nil {
+			t.Fatalf("error reading public key, err=%v", err)
+		}
+		priv, err := Ed25519LoadPrivateKey([]byte(private), nil)
+		if err != nil {
+			t.Fatalf("error reading private key, err=%v", err)
+		}
+		pubs = append(pubs, pub)
+		privs = append(privs, priv)
+	}
+	return pubs, privs
+}
+
+func TestEd25519__SignAndVerify(t *testing.T) {
+	pubs, privs := newEd25519Keys(t, 3)
+
+	message := []byte("this is a test message")
+	sig, err := Ed25519Sign(privs[:2], message)
+	if err != nil {
+		t.Fatalf("error signing message, err=%v", err)
+	}
+
+	body, signers, err := Ed25519Verify(pubs, 2, []byte(sig))
+	if err != nil {
+		t.Fatalf("error verifying signatures, err=%v", err)
+	}
+	if string(body) != string(message) {
+		t.Fatal("verified message does not match signed message")
+	}
+	if len(signers) != 2 || signers[0] != Ed25519Fingerprint(pubs[0]) {
+		t.Fatalf("unexpected signers: %v", signers)
+	}
+	if _, _, err := Ed25519Verify(pubs, 3, []byte(sig)); err == nil {
+		t.Fatal("expected an error when threshold is not met")
+	}
+	if _, _, err := Ed25519Verify(pubs[1:], 1, []byte(sig)); err == nil {
+		t.Fatal("expected an error when signed by an unknown key")
+	}
+
+	// tampering with the message invalidates the signature
+	tampered := []byte(sig)
+	tampered[0] = 'T'
+	if _, _, err := Ed25519Verify(pubs, 1, tampered); err == nil {
+		t.Fatal("expected an error verifying tampered message")
+	}
+	if _, _, err := Ed25519Verify(pubs, 1, []byte(sig+"junk")); err == nil {
+		t.Fatal("expected an error verifying proof with trailing junk")
+	}
+}
+
+func TestEd25519__Cosign(t *testing.T) {
+	pubs, privs := newEd25519Keys(t, 3)
+	message := []byte("this is a test message")
+
+	// officers sign separately: the first signs, the others add their signatures
+	sig, err := Ed25519Sign(privs[:1], message)
+	if err != nil {
+		t.Fatalf("error signing message, err=%v", err)
+	}
+	for _, priv := range privs[1:] {
+		sig, err = Ed25519Signer{Keys: []ed25519.PrivateKey{priv}}.Cosign([]byte(sig))
+		if err != nil {
+			t.Fatalf("error cosigning message, err=%v", err)
+		}
+	}
+	body, signers, err := Ed25519Verify(pubs, 3, []byte(sig))
+	if err != nil {
+		t.Fatalf("error verifying cosigned message, err=%v", err)
+	}
+	if string(body) != string(message) || len(signers) != 3 || signers[2] != Ed25519Fingerprint(pubs[2]) {
+		t.Fatalf("unexpected signers %v or message %q", signers, body)
+	}
+	if _, err := Ed25519Cosign(privs[:1], []byte(sig)); err == nil {
+		t.Fatal("expected an error cosigning with the same key")
+	}
+	if _, err := Ed25519Cosign(privs[:1], message); err == nil {
+		t.Fatal("expected an error cosigning message without signatures")
+	}
+}
+
+func TestEd25519__EncryptedKey(t *testing.T) {
+	public, private, err := Ed25519GenerateKey([]byte("passphrase"))
+	if err != nil {
+		t.Fatalf("error creating ed25519 keys, err=%v", err)
+	}
+	if strings.Contains(private, "BEGIN "+Ed25519PrivateKeyType) {
+		t.Fatal("expected the private key to be encrypted")
+	}
+	if _, err := Ed25519LoadPrivateKey([]byte(private), nil); err != ErrEd25519PassphraseMissing {
+		t.Fatalf("expected ErrEd25519PassphraseMissing, got %v", err)
+	}
+	if _, err := Ed25519LoadPrivateKey([]byte(private), []byte("wrong")); err == nil {
+		t.Fatal("expected an error decrypting with the wrong passphrase")
+	}
+	priv, err := Ed25519LoadPrivateKey([]byte(private), []byte("passphrase"))
+	if err != nil {
+		t.Fatalf("error decrypting private key, err=%v", err)
+	}
+	pub, err := Ed25519LoadPublicKey([]byte(public))
+	if err != nil || !pub.Equal(priv.Public()) {
+		t.Fatal("decrypted private key does not match public key")
+	}
+}
+
+func TestEd25519__LoadKeyring(t *testing.T) {
+	pubs, _ := newEd25519Keys(t, 2)
+	keys := Ed25519ArmorPublicKey(pubs[0]) + Ed25519ArmorPublicKey(pubs[1])
+
+	verifier, err := LoadVerifier(BackendEd25519, []byte(keys), 2)
+	if err != nil {
+		t.Fatalf("error loading verifier, err=%v", err)
+	}
+	armored, err := verifier.PublicKeys()
+	if err != nil || armored != keys {
+		t.Fatal("public keys of verifier do not match keyring")
+	}
+	if _, err := LoadVerifier(BackendEd25519, []byte(keys), 3); err == nil {
+		t.Fatal("expected an error when threshold exceeds keyring")
+	}
+	if _, err := LoadVerifier(BackendEd25519, []byte(""), 1); err == nil {
+		t.Fatal("expected an error loading empty keyring")
+	}
+}
@@ -0,0 +1,97 @@
+package fugl
+
+import (
+	"strings"
+)
+
+/* Validation errors carry a stable code (for machines, e.g. returned by the server),
+ * along with the canary field concerned and the expected and actual values (where applicable).
+ *
+ * Callers branch on the code, not the message:
+ *
+ *   if ErrorCode(err) == ErrCodeExpired { ... }
+ */
+
+const (
+	ErrCodeInvalidProof       = "invalid_proof"       // proof can not be opened (signature or layout)
+	ErrCodeMissingProof       = "missing_proof"       // no proof submitted
+	ErrCodeConflict           = "conflict"            // another proof was accepted concurrently
+	ErrCodeUnsupportedVersion = "unsupported_version" // version not supported
+	ErrCodeInvalidNonce       = "invalid_nonce"       // nonce of wrong length
+	ErrCodeExpired            = "expired"             // canary has expired
+	ErrCodeMissingAuthor      = "missing_author"      // author field empty
+	ErrCodeNotYetValid        = "not_yet_valid"       // creation time in the future
+	ErrCodeInvalidPromise     = "invalid_promise"     // promise without identifier or text
+	ErrCodeDuplicatePromise   = "duplicate_promise"   // promise identifier used twice
+	ErrCodeInvalidRotation    = "invalid_rotation"    // key rotation malformed or can not be followed
+	ErrCodeInvalidFreshness   = "invalid_freshness"   // freshness anchors malformed
+	ErrCodeStaleFreshness     = "stale_freshness"     // freshness anchors missing or not matching trusted values
+	ErrCodeUnknownPrevious    = "unknown_previous"    // links to a proof when none is known
+	ErrCodeBrokenLink         = "broken_link"         // does not link to the current proof
+	ErrCodeFinal              = "final"               // current canary is final
+	ErrCodeCreationOrder      = "creation_order"      // created before the current canary
+	ErrCodeExpiryOrder        = "expiry_order"        // does not expire after the current canary
+	ErrCodeExpiryWindow       = "expiry_window"       // policy: expiry too far after creation
+	ErrCodeInterval           = "interval"            // policy: created too soon after the current canary
+	ErrCodeAuthor             = "author"              // policy: author not allowed
+	ErrCodeMissingPromise     = "missing_promise"     // policy: required promise missing
+	ErrCodeFinalDenied        = "final_denied"        // policy: final canaries not allowed
+)
+
+type ValidationError struct {
+	Code     string `json:"code"`
+	Field    string `json:"field,omitempty"`    // canary field concerned (as named in the JSON)
+	Expected string `json:"expected,omitempty"` // expected value (if applicable)
+	Actual   string `json:"actual,omitempty"`   // actual value (if applicable)
+	Message  string `json:"message"`            // human readable description
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// errors with the same code match (e.g. errors.Is(err, &ValidationError{Code: ErrCodeExpired}))
+func (e *ValidationError) Is(target error) bool {
+	other, ok := target.(*ValidationError)
+	return ok && other.Code == e.Code
+}
+
+func validationError(code string, field string, message string) *ValidationError {
+	return &ValidationError{Code: code, Field: field, Message: message}
+}
+
+// like validationError, with the expected and actual values
+func mismatchError(code string, field string, expected string, actual string, message string) *ValidationError {
+	return &ValidationError{Code: code, Field: field, Expected: expected, Actual: actual, Message: message}
+}
+
+/* Every rule violated by a canary (see Canary.Validate), in the order the rules are checked
+ */
+
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// returns the first violation (nil if there are none)
+func (errs ValidationErrors) Err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[0]
+}
+
+/* Returns the code of a validation error (empty for other errors)
+ */
+
+func ErrorCode(err error) string {
+	if e, ok := err.(*ValidationError); ok {
+		return e.Code
+	}
+	return ""
+}
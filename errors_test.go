@@ -0,0 +1,96 @@
+package fugl
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestErrors__Codes(t *testing.T) {
+	now := time.Now()
+	canary := Canary{
+		Version:  CanaryVersion,
+		Author:   "John Doe",
+		Creation: CanaryTime(now.Add(-time.Hour)),
+		Expiry:   CanaryTime(now.Add(time.Hour)),
+		Nonce:    GetRandStr(CanaryNonceSize),
+	}
+	cases := map[string]func(c *Canary){
+		ErrCodeUnsupportedVersion: func(c *Canary) { c.Version = CanaryVersion + 1 },
+		ErrCodeInvalidNonce:       func(c *Canary) { c.Nonce = "short" },
+		ErrCodeExpired:            func(c *Canary) { c.Expiry = CanaryTime(now.Add(-time.Minute)) },
+		ErrCodeMissingAuthor:      func(c *Canary) { c.Author = "" },
+		ErrCodeNotYetValid:        func(c *Canary) { c.Creation = CanaryTime(now.Add(time.Minute)) },
+		ErrCodeDuplicatePromise:   func(c *Canary) { c.Promises = []Promise{{ID: "a", Text: "a"}, {ID: "a", Text: "b"}} },
+		ErrCodeInvalidFreshness:   func(c *Canary) { c.Freshness = []FreshnessAnchor{{Source: "news"}} },
+	}
+	for code, invalidate := range cases {
+		c := canary
+		invalidate(&c)
+		err := CheckCanaryFormat(&c, now)
+		if ErrorCode(err) != code {
+			t.Fatalf("expected error code %s, got %v", code, err)
+		}
+		if !err.(*ValidationError).Is(&ValidationError{Code: code}) {
+			t.Fatalf("expected error to match code %s", code)
+		}
+	}
+
+	// expected and actual values of a broken link
+	next := canary
+	next.Previous = HashString("other proof")
+	err := CheckCanaryPrevious(&next, &canary, "proof")
+	if ErrorCode(err) != ErrCodeBrokenLink {
+		t.Fatalf("expected broken link, got %v", err)
+	}
+	encoded, _ := json.Marshal(err)
+	var decoded ValidationError
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("error decoding validation error, err=%v", err)
+	}
+	if decoded.Field != "previous" || decoded.Expected != HashString("proof") || decoded.Actual != next.Previous {
+		t.Fatalf("unexpected validation error: %s", encoded)
+	}
+	if ErrorCode(ErrProofNotFound) != "" {
+		t.Fatal("expected no code for other errors")
+	}
+}
+
+func TestErrors__Validate(t *testing.T) {
+	now := time.Now()
+	old := Canary{
+		Creation: CanaryTime(now),
+		Expiry:   CanaryTime(now.Add(time.Hour)),
+		Final:    true,
+	}
+	canary := Canary{
+		Version:  CanaryVersion + 1,
+		Nonce:    "short",
+		Creation: CanaryTime(now.Add(-time.Hour)),
+		Expiry:   CanaryTime(now.Add(-time.Minute)),
+		Previous: HashString("other proof"),
+	}
+
+	// every violation is reported, in order
+	errs := append(canary.Validate(now), canary.ValidatePrevious(&old, "proof")...)
+	codes := []string{
+		ErrCodeUnsupportedVersion, ErrCodeInvalidNonce, ErrCodeExpired, ErrCodeMissingAuthor,
+		ErrCodeBrokenLink, ErrCodeFinal, ErrCodeCreationOrder, ErrCodeExpiryOrder,
+	}
+	if len(errs) != len(codes) {
+		t.Fatalf("expected %d violations, got: %v", len(codes), errs)
+	}
+	for i, code := range codes {
+		if errs[i].Code != code {
+			t.Fatalf("expected violation %s, got %s", code, errs[i].Code)
+		}
+	}
+
+	// the checks return the first violation
+	if ErrorCode(CheckCanaryFormat(&canary, now)) != ErrCodeUnsupportedVersion {
+		t.Fatal("expected the first violation from CheckCanaryFormat")
+	}
+	if err := (ValidationErrors{}).Err(); err != nil {
+		t.Fatalf("expected no error without violations, got %v", err)
+	}
+}
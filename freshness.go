@@ -0,0 +1,103 @@
+package fugl
+
+import (
+	"errors"
+	"strings"
+)
+
+/* A canary may embed freshness anchors:
+ * externally observable values (e.g. a recent block hash or a news headline)
+ * which could not have been known before the canary was created.
+ *
+ * The anchors are covered by the signatures,
+ * the verifier compares them against values it trusts (see CheckCanaryFreshness),
+ * hence a proof can not have been generated long in advance.
+ */
+
+type FreshnessAnchor struct {
+	Source string `json:"source"` // Label of the source (e.g. "bitcoin-block")
+	Value  string `json:"value"`  // Value observed from the source
+}
+
+/* Supplies the values of a source trusted by the verifier (e.g. the most recent block hashes),
+ * returns no values if the source is unknown to the verifier
+ */
+
+type FreshnessLookup func(source string) ([]string, error)
+
+func checkFreshnessFormat(anchors []FreshnessAnchor) error {
+	sources := make(map[string]bool)
+	for _, anchor := range anchors {
+		if anchor.Source == "" || anchor.Value == "" {
+			return errors.New("Freshness anchor must specify source and value")
+		}
+		if sources[anchor.Source] {
+			return errors.New("Duplicate freshness source: " + anchor.Source)
+		}
+		sources[anchor.Source] = true
+	}
+	return nil
+}
+
+func freshnessEqual(a []FreshnessAnchor, b []FreshnessAnchor) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+/* Every anchor from a source known to the verifier must match a trusted value,
+ * and at least one anchor must be known
+ */
+
+func CheckCanaryFreshness(canary *Canary, lookup FreshnessLookup) error {
+	if len(canary.Freshness) == 0 {
+		return validationError(ErrCodeStaleFreshness, "freshness", "Canary has no freshness anchors")
+	}
+	checked := 0
+	for _, anchor := range canary.Freshness {
+		values, err := lookup(anchor.Source)
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			continue
+		}
+		found := false
+		for _, value := range values {
+			if value == anchor.Value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return mismatchError(ErrCodeStaleFreshness, "freshness", strings.Join(values, ", "), anchor.Value,
+				"Freshness anchor does not match trusted value: "+anchor.Source)
+		}
+		checked++
+	}
+	if checked == 0 {
+		return validationError(ErrCodeStaleFreshness, "freshness", "Canary has no freshness anchors from trusted sources")
+	}
+	return nil
+}
+
+/* Lookup using a fixed set of trusted anchors
+ */
+
+func TrustedFreshness(anchors []FreshnessAnchor) FreshnessLookup {
+	return func(source string) ([]string, error) {
+		var values []string
+		for _, anchor := range anchors {
+			if anchor.Source == source {
+				values = append(values, anchor.Value)
+			}
+		}
+		return values, nil
+	}
+}
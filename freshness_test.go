@@ -0,0 +1,80 @@
+package fugl
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFreshness__Check(t *testing.T) {
+	canary := Canary{
+		Version:  CanaryVersion,
+		Author:   "John Doe",
+		Creation: CanaryTime(time.Now()),
+		Expiry:   CanaryTime(time.Now().Add(time.Hour)),
+		Nonce:    GetRandStr(CanaryNonceSize),
+		Freshness: []FreshnessAnchor{
+			{Source: "bitcoin-block", Value: "00000000000000000002a7c4"},
+			{Source: "headline", Value: "Local bird sings"},
+		},
+	}
+	if err := CheckCanaryFormat(&canary, time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("error checking canary with freshness anchors, err=%v", err)
+	}
+
+	trusted := TrustedFreshness([]FreshnessAnchor{
+		{Source: "bitcoin-block", Value: "00000000000000000001f3e9"},
+		{Source: "bitcoin-block", Value: "00000000000000000002a7c4"},
+	})
+	if err := CheckCanaryFreshness(&canary, trusted); err != nil {
+		t.Fatalf("error checking freshness against trusted values, err=%v", err)
+	}
+
+	stale := TrustedFreshness([]FreshnessAnchor{{Source: "bitcoin-block", Value: "00000000000000000003b0d1"}})
+	if err := CheckCanaryFreshness(&canary, stale); err == nil {
+		t.Fatal("expected an error when anchor does not match the trusted value")
+	}
+	unknown := TrustedFreshness([]FreshnessAnchor{{Source: "weather", Value: "rain"}})
+	if err := CheckCanaryFreshness(&canary, unknown); err == nil {
+		t.Fatal("expected an error when no anchor is from a trusted source")
+	}
+	failing := func(source string) ([]string, error) {
+		return nil, errors.New("source unavailable")
+	}
+	if err := CheckCanaryFreshness(&canary, failing); err == nil {
+		t.Fatal("expected an error when the lookup fails")
+	}
+	if err := CheckCanaryFreshness(&Canary{}, trusted); err == nil {
+		t.Fatal("expected an error when canary has no freshness anchors")
+	}
+
+	// anchors are part of the signed canary
+	ser, err := SerializeCanary(canary)
+	if err != nil {
+		t.Fatalf("error serializing canary, err=%v", err)
+	}
+	parsed, err := ParseCanary(ser)
+	if err != nil {
+		t.Fatalf("error parsing canary, err=%v", err)
+	}
+	if !canary.Equal(*parsed) {
+		t.Fatal("parsed canary does not match serialized canary")
+	}
+	canary.Version = 0
+	if _, err := SerializeCanary(canary); err == nil {
+		t.Fatal("expected an error serializing freshness anchors in version 0")
+	}
+}
+
+func TestFreshness__Format(t *testing.T) {
+	invalid := [][]FreshnessAnchor{
+		{{Source: "", Value: "value"}},
+		{{Source: "source", Value: ""}},
+		{{Source: "source", Value: "a"}, {Source: "source", Value: "b"}},
+	}
+	for i, anchors := range invalid {
+		if err := checkFreshnessFormat(anchors); err == nil {
+			t.Fatalf("%d: expected an error for invalid freshness anchors", i)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package fugl
+
+import (
+	"time"
+)
+
+/* Integrity check of a store (fsck):
+ * every stored proof must verify (following key rotations)
+ * and every proof must supersede the preceding proof (see CheckCanaryPrevious).
+ *
+ * The first stored proof may link to a proof which is not stored (e.g. after pruning).
+ * Given the archives of pruned proofs (see ArchiveStore),
+ * the archived proofs between stored proofs are verified as part of the chain.
+ */
+
+const (
+	StoreIssueSignature = "signature" // proof does not verify
+	StoreIssueDuplicate = "duplicate" // proof stored twice, or another proof already supersedes the same proof
+	StoreIssueGap       = "gap"       // proof does not link to the preceding proof (proofs are missing)
+	StoreIssueLink      = "link"      // proof links to the preceding proof, but can not supersede it
+)
+
+type StoreIssue struct {
+	Hash    string // hash of the offending proof
+	Kind    string // one of the StoreIssue constants
+	Message string
+}
+
+func (issue StoreIssue) Error() string {
+	return issue.Kind + ": " + issue.Hash + ": " + issue.Message
+}
+
+type StoreReport struct {
+	Checked int          // number of proofs checked
+	Chain   []string     // proofs forming the chain (oldest first), excluding offenders
+	Issues  []StoreIssue // problems found, in the order of the proofs
+}
+
+/* Checks every proof in the store, using the verifier of the oldest proof.
+ * Proofs with gaps before them are kept in the chain, all other offenders are excluded.
+ */
+
+func CheckStore(store Store, verifier Verifier, archives ...*Archive) (*StoreReport, error) {
+	proofs, err := store.List(time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	archived := make(map[string]string) // hash -> archived proof
+	links := make(map[string]string)    // hash -> previous hash, of archived proofs
+	for _, archive := range archives {
+		for _, entry := range archive.Manifest.Proofs {
+			archived[entry.Hash] = archive.Proofs[entry.Hash]
+			links[entry.Hash] = entry.Previous
+		}
+	}
+	report := &StoreReport{Checked: len(proofs)}
+	seen := make(map[string]bool)       // hashes of proofs checked
+	superseded := make(map[string]bool) // hashes of proofs superseded by a proof in the chain
+	var prevProof string
+	var prevCanary *Canary
+	for _, proof := range proofs {
+		hash := HashString(proof)
+		issue := func(kind string, message string) {
+			report.Issues = append(report.Issues, StoreIssue{Hash: hash, Kind: kind, Message: message})
+		}
+		if seen[hash] {
+			issue(StoreIssueDuplicate, "Proof stored more than once")
+			continue
+		}
+		seen[hash] = true
+		opened, err := VerifyProof(verifier, proof)
+		if err != nil {
+			issue(StoreIssueSignature, err.Error())
+			continue
+		}
+		canary := opened.Canary
+		if canary.Previous != "" && superseded[canary.Previous] {
+			issue(StoreIssueDuplicate, "Previous proof already superseded by another proof")
+			continue
+		}
+
+		// follow archived proofs in between
+		expected := ""
+		if prevCanary != nil {
+			expected = HashString(prevProof)
+		}
+		if canary.Previous != expected {
+			for _, old := range archivedRun(links, canary.Previous, expected) {
+				oldCanary, next, kind, err := checkArchived(verifier, archived[old], prevCanary, prevProof)
+				if err != nil {
+					report.Issues = append(report.Issues, StoreIssue{Hash: old, Kind: kind, Message: "Archived proof: " + err.Error()})
+					break
+				}
+				verifier = next
+				prevProof, prevCanary = archived[old], oldCanary
+			}
+		}
+
+		if prevCanary != nil {
+			if canary.Previous != HashString(prevProof) {
+				issue(StoreIssueGap, "Proof does not link to preceding proof")
+			} else if err := CheckCanaryPrevious(canary, prevCanary, prevProof); err != nil {
+				issue(StoreIssueLink, err.Error())
+				continue
+			}
+		}
+		next, err := verifier.Rotate(canary.Rotation)
+		if err != nil {
+			issue(StoreIssueLink, err.Error())
+			continue
+		}
+		verifier = next
+		if canary.Previous != "" {
+			superseded[canary.Previous] = true
+		}
+		report.Chain = append(report.Chain, proof)
+		prevProof, prevCanary = proof, canary
+	}
+	return report, nil
+}
+
+/* Returns the hashes of the archived proofs preceding the proof linking to hash (oldest first),
+ * following the links back until the proof with hash stop.
+ * Returns nil if stop is not reached (unless stop is empty)
+ */
+
+func archivedRun(links map[string]string, hash string, stop string) []string {
+	var run []string
+	for hash != stop {
+		previous, ok := links[hash]
+		if !ok || len(run) > len(links) {
+			break
+		}
+		run = append([]string{hash}, run...)
+		hash = previous
+	}
+	if stop != "" && hash != stop {
+		return nil
+	}
+	return run
+}
+
+func checkArchived(verifier Verifier, proof string, prevCanary *Canary, prevProof string) (*Canary, Verifier, string, error) {
+	opened, err := VerifyProof(verifier, proof)
+	if err != nil {
+		return nil, nil, StoreIssueSignature, err
+	}
+	if prevCanary != nil {
+		if err := CheckCanaryPrevious(opened.Canary, prevCanary, prevProof); err != nil {
+			return nil, nil, StoreIssueLink, err
+		}
+	}
+	next, err := verifier.Rotate(opened.Canary.Rotation)
+	if err != nil {
+		return nil, nil, StoreIssueLink, err
+	}
+	return opened.Canary, next, "", nil
+}
+
+/* Stores able to set offending proofs aside,
+ * quarantined proofs are no longer listed (nor counted) by the store
+ */
+
+type QuarantineStore interface {
+	Quarantine(hash string) error
+}
+
+/* Quarantines the offenders of a report (except proofs following a gap),
+ * returns the number of proofs quarantined
+ */
+
+func QuarantineIssues(store QuarantineStore, report *StoreReport) (int, error) {
+	skip := make(map[string]bool) // proofs in the chain or already quarantined
+	for _, proof := range report.Chain {
+		skip[HashString(proof)] = true
+	}
+	count := 0
+	for _, issue := range report.Issues {
+		if skip[issue.Hash] {
+			continue
+		}
+		if err := store.Quarantine(issue.Hash); err != nil {
+			return count, err
+		}
+		skip[issue.Hash] = true
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,89 @@
+package fugl
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStore__Check(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fugl-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, _ := NewDirectoryStore(dir + "/proofs")
+
+	pubs, privs := newEd25519Keys(t, 2)
+	now := time.Now()
+	save := func(hours int, previous string, created int, key int) string {
+		canary := Canary{
+			Version:  CanaryVersion,
+			Author:   "John Doe",
+			Creation: CanaryTime(now.Add(time.Duration(created) * time.Hour)),
+			Expiry:   CanaryTime(now.Add(time.Duration(hours) * time.Hour)),
+			Nonce:    GetRandStr(CanaryNonceSize),
+			Previous: previous,
+		}
+		proof, err := SealProof(Ed25519Signer{Keys: privs[key : key+1]}, canary, "")
+		if err != nil {
+			t.Fatalf("error sealing proof, err=%v", err)
+		}
+		if err := store.Save(proof, &canary); err != nil {
+			t.Fatalf("error saving proof, err=%v", err)
+		}
+		return proof
+	}
+	p0 := save(1, "", 0, 0)
+	p1 := save(2, HashString(p0), 1, 0)
+	bad := save(3, HashString(p1), 2, 1)        // wrong key
+	fork := save(4, HashString(p0), 2, 0)       // p0 already superseded
+	p2 := save(5, HashString(p1), 2, 0)         // valid
+	gap := save(7, HashString("missing"), 4, 0) // missing proofs
+	link := save(8, HashString(gap), 3, 0)      // created before gap
+
+	report, err := CheckStore(store, Ed25519Verifier{Keys: pubs[:1]})
+	if err != nil {
+		t.Fatalf("error checking store, err=%v", err)
+	}
+	if report.Checked != 7 {
+		t.Fatalf("expected 7 proofs checked, got %d", report.Checked)
+	}
+	chain := []string{p0, p1, p2, gap}
+	if len(report.Chain) != len(chain) {
+		t.Fatalf("expected chain of %d proofs, got %d", len(chain), len(report.Chain))
+	}
+	for i := range chain {
+		if report.Chain[i] != chain[i] {
+			t.Fatalf("unexpected proof %d in chain", i)
+		}
+	}
+	expected := []StoreIssue{
+		{Hash: HashString(bad), Kind: StoreIssueSignature},
+		{Hash: HashString(fork), Kind: StoreIssueDuplicate},
+		{Hash: HashString(gap), Kind: StoreIssueGap},
+		{Hash: HashString(link), Kind: StoreIssueLink},
+	}
+	if len(report.Issues) != len(expected) {
+		t.Fatalf("unexpected issues: %v", report.Issues)
+	}
+	for i, issue := range report.Issues {
+		if issue.Hash != expected[i].Hash || issue.Kind != expected[i].Kind {
+			t.Fatalf("unexpected issue %d: %v", i, issue)
+		}
+	}
+
+	// offenders are set aside, the gap remains
+	count, err := QuarantineIssues(store, report)
+	if err != nil || count != 3 {
+		t.Fatalf("expected 3 proofs quarantined, got %d (err=%v)", count, err)
+	}
+	if count, _ := store.Count(); count != 4 {
+		t.Fatalf("expected 4 proofs after quarantine, got %d", count)
+	}
+	report, err = CheckStore(store, Ed25519Verifier{Keys: pubs[:1]})
+	if err != nil || len(report.Issues) != 1 || report.Issues[0].Kind != StoreIssueGap {
+		t.Fatalf("expected only the gap after quarantine, got %v (err=%v)", report.Issues, err)
+	}
+}
@@ -2,11 +2,16 @@ package fugl
 
 import (
 	"bytes"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/armor"
 	"golang.org/x/crypto/openpgp/clearsign"
 	"golang.org/x/crypto/openpgp/packet"
+	"io"
+	"io/ioutil"
+	"strings"
 )
 
 func PGPLoadPrivateKey(key []byte) (*openpgp.Entity, error) {
@@ -29,14 +34,82 @@ func PGPLoadPublicKey(key []byte) (*openpgp.Entity, error) {
 	return openpgp.ReadEntity(packet.NewReader(block.Body))
 }
 
+/* Loads every public key from a keyring,
+ * which may contain multiple keys per armored block and multiple blocks
+ */
+
+func PGPLoadKeyring(keys []byte) (openpgp.EntityList, error) {
+	var keyring openpgp.EntityList
+	marker := []byte("-----BEGIN " + openpgp.PublicKeyType + "-----")
+	for {
+		start := bytes.Index(keys, marker)
+		if start < 0 {
+			break
+		}
+		keys = keys[start:]
+		end := bytes.Index(keys[len(marker):], marker)
+		if end < 0 {
+			end = len(keys)
+		} else {
+			end += len(marker)
+		}
+		entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keys[:end]))
+		if err != nil {
+			return nil, err
+		}
+		keyring = append(keyring, entities...)
+		keys = keys[end:]
+	}
+	if len(keyring) == 0 {
+		return nil, errors.New("No OpenPGP public keys found")
+	}
+	return keyring, nil
+}
+
+func PGPArmorPublicKey(entity *openpgp.Entity) (string, error) {
+	var out bytes.Buffer
+	writer, err := armor.Encode(&out, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return "", err
+	}
+	err = entity.Serialize(writer)
+	if err != nil {
+		return "", err
+	}
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func PGPFingerprint(entity *openpgp.Entity) string {
+	return strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint[:]))
+}
+
 func PGPSign(entity *openpgp.Entity, message []byte) (string, error) {
-	if entity.PrivateKey == nil {
-		return "", errors.New("invalid private key")
+	return PGPSignMulti([]*openpgp.Entity{entity}, message)
+}
+
+/* Clear signs the message with every entity,
+ * the signatures are stored together in the signature block
+ */
+
+func PGPSignMulti(entities []*openpgp.Entity, message []byte) (string, error) {
+	if len(entities) == 0 {
+		return "", errors.New("no private keys supplied")
+	}
+	keys := make([]*packet.PrivateKey, 0, len(entities))
+	for _, entity := range entities {
+		if entity == nil || entity.PrivateKey == nil {
+			return "", errors.New("invalid private key")
+		}
+		keys = append(keys, entity.PrivateKey)
 	}
 
 	// create signature writer
 	var outSig bytes.Buffer
-	writer, err := clearsign.Encode(&outSig, entity.PrivateKey, nil)
+	writer, err := clearsign.EncodeMulti(&outSig, keys, nil)
 	if err != nil {
 		return "", err
 	}
@@ -53,27 +126,199 @@ func PGPSign(entity *openpgp.Entity, message []byte) (string, error) {
 	return outSig.String(), err
 }
 
-func PGPVerify(entity *openpgp.Entity, signature []byte) (*clearsign.Block, error) {
-	if entity == nil {
-		return nil, errors.New("invalid public key")
+/* Adds the signatures of every entity to a clear signed message,
+ * keeping the existing signatures (e.g. of officers signing separately)
+ */
+
+func PGPCosign(entities []*openpgp.Entity, signature []byte) (string, error) {
+	block, rest := clearsign.Decode(signature)
+	if block == nil {
+		return "", errors.New("Unable to read pgp block")
+	}
+	if len(rest) > 0 {
+		return "", errors.New("Proof contains junk")
+	}
+	existing, err := ioutil.ReadAll(block.ArmoredSignature.Body)
+	if err != nil {
+		return "", errors.New("Unable to read signature")
+	}
+
+	// refuse signing twice with the same key
+	packets := packet.NewReader(bytes.NewReader(existing))
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", errors.New("Unable to read signature")
+		}
+		sig, ok := p.(*packet.Signature)
+		if !ok || sig.IssuerKeyId == nil {
+			continue
+		}
+		for _, entity := range entities {
+			if entity != nil && entity.PrivateKey != nil && entity.PrivateKey.KeyId == *sig.IssuerKeyId {
+				return "", errors.New("Proof already signed by: " + PGPFingerprint(entity))
+			}
+		}
+	}
+
+	// sign the same text, the hash must be declared by the message
+	signed, err := PGPSignMulti(entities, block.Plaintext)
+	if err != nil {
+		return "", err
+	}
+	added, _ := clearsign.Decode([]byte(signed))
+	if added == nil || !bytes.Equal(added.Bytes, block.Bytes) {
+		return "", errors.New("Unable to sign the text of the proof")
+	}
+	declared := strings.Join(block.Headers["Hash"], ",")
+	for _, hash := range added.Headers["Hash"] {
+		if !strings.Contains(","+declared+",", ","+hash+",") {
+			return "", errors.New("Proof does not declare the hash: " + hash)
+		}
+	}
+	signatures, err := ioutil.ReadAll(added.ArmoredSignature.Body)
+	if err != nil {
+		return "", err
+	}
+
+	// replace the signature block by the existing and added signatures
+	var out bytes.Buffer
+	index := bytes.LastIndex(signature, []byte("-----BEGIN "+openpgp.SignatureType+"-----"))
+	out.Write(signature[:index])
+	writer, err := armor.Encode(&out, openpgp.SignatureType, nil)
+	if err != nil {
+		return "", err
+	}
+	_, err = writer.Write(append(existing, signatures...))
+	if err != nil {
+		return "", err
+	}
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func PGPVerify(keyring openpgp.EntityList, signature []byte) (*clearsign.Block, []string, error) {
+	return PGPVerifyThreshold(keyring, 1, signature)
+}
+
+/* Verifies every signature in the signature block,
+ * requiring valid signatures from at least threshold distinct keys in the keyring.
+ *
+ * Returns the fingerprints of the signing keys.
+ */
+
+func PGPVerifyThreshold(keyring openpgp.EntityList, threshold int, signature []byte) (*clearsign.Block, []string, error) {
+	if len(keyring) == 0 {
+		return nil, nil, errors.New("invalid public key")
+	}
+	for _, entity := range keyring {
+		if entity == nil {
+			return nil, nil, errors.New("invalid public key")
+		}
+	}
+	if threshold < 1 || threshold > len(keyring) {
+		return nil, nil, errors.New("Invalid signature threshold")
 	}
 
 	// parse clear signature
 	block, rest := clearsign.Decode(signature)
 	if len(rest) > 0 {
-		return nil, errors.New("Proof contains junk")
+		return nil, nil, errors.New("Proof contains junk")
 	}
 	if block == nil {
-		return nil, errors.New("Unable to read pgp block")
+		return nil, nil, errors.New("Unable to read pgp block")
 	}
 
-	// verify signature
-	keyring := make(openpgp.EntityList, 1)
-	keyring[0] = entity
-	content := bytes.NewReader(block.Bytes)
-	_, err := openpgp.CheckDetachedSignature(keyring, content, block.ArmoredSignature.Body)
+	// verify signatures one at a time
+	var signers []string
+	seen := make(map[string]bool)
+	packets := packet.NewOpaqueReader(block.ArmoredSignature.Body)
+	for {
+		op, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, errors.New("Unable to read signature")
+		}
+		var sig bytes.Buffer
+		err = op.Serialize(&sig)
+		if err != nil {
+			return nil, nil, err
+		}
+		content := bytes.NewReader(block.Bytes)
+		signer, err := openpgp.CheckDetachedSignature(keyring, content, &sig)
+		if err != nil {
+			return nil, nil, errors.New("Invalid signature")
+		}
+		fingerprint := PGPFingerprint(signer)
+		if !seen[fingerprint] {
+			seen[fingerprint] = true
+			signers = append(signers, fingerprint)
+		}
+	}
+	if len(signers) < threshold {
+		return nil, nil, errors.New(fmt.Sprintf("Signed by %d keys, %d required", len(signers), threshold))
+	}
+	return block, signers, nil
+}
+
+/* PGP signature backend (clear signed messages)
+ */
+
+type PGPSigner struct {
+	Keys []*openpgp.Entity // private keys, each producing a signature
+}
+
+type PGPVerifier struct {
+	Keyring   openpgp.EntityList // public keys of signers
+	Threshold int                // number of signatures required (0 is treated as 1)
+}
+
+func (s PGPSigner) Sign(message []byte) (string, error) {
+	return PGPSignMulti(s.Keys, message)
+}
+
+func (s PGPSigner) Cosign(proof []byte) (string, error) {
+	return PGPCosign(s.Keys, proof)
+}
+
+func (v PGPVerifier) Verify(proof []byte) ([]byte, []string, error) {
+	threshold := v.Threshold
+	if threshold == 0 {
+		threshold = 1
+	}
+	block, signers, err := PGPVerifyThreshold(v.Keyring, threshold, proof)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// signed text has CRLF line endings, other backends use LF
+	return bytes.Replace(block.Bytes, []byte("\r\n"), []byte("\n"), -1), signers, nil
+}
+
+func (v PGPVerifier) Rotate(rotation *KeyRotation) (Verifier, error) {
+	keyring, err := RotateKeyring(v.Keyring, rotation)
 	if err != nil {
-		return nil, errors.New("Invalid signature")
+		return nil, err
+	}
+	return PGPVerifier{Keyring: keyring, Threshold: v.Threshold}, nil
+}
+
+func (v PGPVerifier) PublicKeys() (string, error) {
+	var armored string
+	for _, entity := range v.Keyring {
+		key, err := PGPArmorPublicKey(entity)
+		if err != nil {
+			return "", err
+		}
+		armored += key + "\n"
 	}
-	return block, nil
+	return armored, nil
 }
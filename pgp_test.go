@@ -6,6 +6,7 @@ import (
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/armor"
 	"testing"
+	"time"
 )
 
 var (
@@ -81,13 +82,16 @@ func TestPGP__SignAndVerify(t *testing.T) {
 		t.Fatal("empty signature created")
 	}
 
-	block, err := PGPVerify(pub, []byte(sig))
+	block, signers, err := PGPVerify(openpgp.EntityList{pub}, []byte(sig))
 	if err != nil {
 		t.Fatalf("error verifying signature, err=%v", err)
 	}
 	if block == nil || len(block.Bytes) == 0 {
 		t.Fatal("verify block is empty")
 	}
+	if len(signers) != 1 || signers[0] != PGPFingerprint(pub) {
+		t.Fatalf("unexpected signers: %v", signers)
+	}
 }
 
 func TestPGP__InvalidSignAndVerify(t *testing.T) {
@@ -103,7 +107,7 @@ func TestPGP__InvalidSignAndVerify(t *testing.T) {
 		t.Fatal("should not get signature on error")
 	}
 
-	block, err := PGPVerify(pub, []byte(""))
+	block, _, err := PGPVerify(openpgp.EntityList{pub}, []byte(""))
 	if err == nil {
 		t.Fatal("expected an error verifying an invalid signature")
 	}
@@ -112,6 +116,148 @@ func TestPGP__InvalidSignAndVerify(t *testing.T) {
 	}
 }
 
+func TestPGP__ThresholdSignAndVerify(t *testing.T) {
+	var pubs []*openpgp.Entity
+	var privs []*openpgp.Entity
+	for i := 0; i < 3; i++ {
+		p, err := newKeypair()
+		if err != nil {
+			t.Fatalf("error creating pgp keys, err=%v", err)
+		}
+		pub, _ := PGPLoadPublicKey([]byte(p.public))
+		priv, _ := PGPLoadPrivateKey([]byte(p.private))
+		pubs = append(pubs, pub)
+		privs = append(privs, priv)
+	}
+	keyring := openpgp.EntityList(pubs)
+
+	// sign with 2 of 3 keys
+	message := []byte("this is a test message")
+	sig, err := PGPSignMulti(privs[:2], message)
+	if err != nil {
+		t.Fatalf("error signing message, err=%v", err)
+	}
+
+	block, signers, err := PGPVerifyThreshold(keyring, 2, []byte(sig))
+	if err != nil {
+		t.Fatalf("error verifying 2 of 3 signatures, err=%v", err)
+	}
+	if block == nil || len(block.Bytes) == 0 {
+		t.Fatal("verify block is empty")
+	}
+	if len(signers) != 2 {
+		t.Fatalf("expected 2 signers, got %v", signers)
+	}
+	if _, _, err := PGPVerifyThreshold(keyring, 3, []byte(sig)); err == nil {
+		t.Fatal("expected an error when threshold is not met")
+	}
+	if _, _, err := PGPVerifyThreshold(keyring, 4, []byte(sig)); err == nil {
+		t.Fatal("expected an error when threshold exceeds keyring")
+	}
+
+	// signatures from the same key count once
+	sig, err = PGPSignMulti([]*openpgp.Entity{privs[0], privs[0]}, message)
+	if err != nil {
+		t.Fatalf("error signing message, err=%v", err)
+	}
+	if _, _, err := PGPVerifyThreshold(keyring, 2, []byte(sig)); err == nil {
+		t.Fatal("expected an error when the same key signs twice")
+	}
+
+	// signatures by unknown keys are rejected
+	sig, err = PGPSignMulti(privs, message)
+	if err != nil {
+		t.Fatalf("error signing message, err=%v", err)
+	}
+	if _, _, err := PGPVerifyThreshold(keyring[:2], 2, []byte(sig)); err == nil {
+		t.Fatal("expected an error when signed by an unknown key")
+	}
+}
+
+func TestPGP__Cosign(t *testing.T) {
+	var pubs []*openpgp.Entity
+	var privs []*openpgp.Entity
+	for i := 0; i < 2; i++ {
+		p, err := newKeypair()
+		if err != nil {
+			t.Fatalf("error creating pgp keys, err=%v", err)
+		}
+		pub, _ := PGPLoadPublicKey([]byte(p.public))
+		priv, _ := PGPLoadPrivateKey([]byte(p.private))
+		pubs = append(pubs, pub)
+		privs = append(privs, priv)
+	}
+	verifier := PGPVerifier{Keyring: openpgp.EntityList(pubs), Threshold: 2}
+
+	// officers sign separately: the first creates the proof, the second adds a signature
+	canary := Canary{
+		Version:  CanaryVersion,
+		Creation: CanaryTime(time.Now().Add(-time.Minute)),
+		Expiry:   CanaryTime(time.Now().Add(time.Hour)),
+		Promises: []Promise{},
+		Nonce:    GetRandStr(CanaryNonceSize),
+	}
+	proof, err := SealProof(PGPSigner{Keys: privs[:1]}, canary, "- description\nspanning lines ")
+	if err != nil {
+		t.Fatalf("error sealing proof, err=%v", err)
+	}
+	if _, err := VerifyProof(verifier, proof); err == nil {
+		t.Fatal("expected an error verifying a single signature")
+	}
+	cosigned, err := CosignProof(PGPSigner{Keys: privs[1:]}, proof)
+	if err != nil {
+		t.Fatalf("error cosigning proof, err=%v", err)
+	}
+	opened, err := VerifyProofStrict(verifier, cosigned)
+	if err != nil {
+		t.Fatalf("error verifying cosigned proof, err=%v", err)
+	}
+	if len(opened.Signers) != 2 || opened.Signers[1] != PGPFingerprint(pubs[1]) {
+		t.Fatalf("unexpected signers: %v", opened.Signers)
+	}
+	if !opened.Canary.Equal(canary) || opened.Description != "- description\nspanning lines" {
+		t.Fatal("cosigned proof does not contain the canary")
+	}
+
+	// signing twice with the same key is refused
+	if _, err := CosignProof(PGPSigner{Keys: privs[1:]}, cosigned); err == nil {
+		t.Fatal("expected an error cosigning with the same key")
+	}
+	if _, err := CosignProof(PGPSigner{Keys: privs[1:]}, cosigned+"junk"); err == nil {
+		t.Fatal("expected an error cosigning proof with trailing junk")
+	}
+}
+
+func TestPGP__LoadKeyring(t *testing.T) {
+	other, err := newKeypair()
+	if err != nil {
+		t.Fatalf("error creating pgp keys, err=%v", err)
+	}
+
+	keyring, err := PGPLoadKeyring([]byte(pair.public + "\n" + other.public))
+	if err != nil {
+		t.Fatalf("error reading keyring, err=%v", err)
+	}
+	if len(keyring) != 2 {
+		t.Fatalf("expected 2 keys in keyring, got %d", len(keyring))
+	}
+
+	// signer is reported by fingerprint
+	priv, _ := PGPLoadPrivateKey([]byte(other.private))
+	sig, _ := PGPSign(priv, []byte("this is a test message"))
+	_, signers, err := PGPVerify(keyring, []byte(sig))
+	if err != nil {
+		t.Fatalf("error verifying signature, err=%v", err)
+	}
+	if len(signers) != 1 || signers[0] != PGPFingerprint(keyring[1]) {
+		t.Fatalf("unexpected signers: %v", signers)
+	}
+
+	if _, err := PGPLoadKeyring([]byte("")); err == nil {
+		t.Fatal("expected an error reading empty keyring")
+	}
+}
+
 // helper functions to generate keys
 
 type keypair struct {
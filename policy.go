@@ -0,0 +1,101 @@
+package fugl
+
+import (
+	"fmt"
+	"time"
+)
+
+/* Validation policy, applied in addition to the rules of CheckCanary.
+ * The zero policy imposes no additional rules.
+ */
+
+type Policy struct {
+	MaxExpiry   time.Duration // maximum time from creation to expiry (zero is unbounded)
+	MinInterval time.Duration // minimum time between the creation of consecutive canaries
+	ClockSkew   time.Duration // tolerated difference between the clocks of signer and verifier
+	Author      string        // required author (empty allows any)
+	Promises    []string      // identifiers of promises every canary must make
+	DenyFinal   bool          // reject final canaries
+}
+
+/* Policy as written in configuration files (e.g. TOML) of the client and server,
+ * durations are given in seconds
+ */
+
+type PolicyConfig struct {
+	MaxExpiry   int64    `toml:"max_expiry"`   // seconds from creation to expiry (0 is unbounded)
+	MinInterval int64    `toml:"min_interval"` // seconds between the creation of consecutive canaries
+	ClockSkew   int64    `toml:"clock_skew"`   // seconds of clock skew tolerated
+	Author      string   `toml:"author"`       // required author
+	Promises    []string `toml:"promises"`     // identifiers of required promises
+	DenyFinal   bool     `toml:"deny_final"`   // reject final canaries
+}
+
+func (c PolicyConfig) Policy() Policy {
+	return Policy{
+		MaxExpiry:   time.Duration(c.MaxExpiry) * time.Second,
+		MinInterval: time.Duration(c.MinInterval) * time.Second,
+		ClockSkew:   time.Duration(c.ClockSkew) * time.Second,
+		Author:      c.Author,
+		Promises:    c.Promises,
+		DenyFinal:   c.DenyFinal,
+	}
+}
+
+func (p Policy) Check(new *Canary, old *Canary, oldProof string, now time.Time) error {
+	err := p.CheckFormat(new, now)
+	if err != nil {
+		return err
+	}
+	return p.CheckPrevious(new, old, oldProof)
+}
+
+func (p Policy) CheckFormat(canary *Canary, now time.Time) error {
+	return p.Validate(canary, now).Err()
+}
+
+func (p Policy) CheckPrevious(new *Canary, old *Canary, oldProof string) error {
+	return p.ValidatePrevious(new, old, oldProof).Err()
+}
+
+/* Returns every violated rule on the fields of the canary, including those of the policy
+ */
+
+func (p Policy) Validate(canary *Canary, now time.Time) ValidationErrors {
+	errs := validateFormat(canary, now, p.ClockSkew)
+	window := canary.Expiry.Time().Sub(canary.Creation.Time())
+	if p.MaxExpiry > 0 && window > p.MaxExpiry {
+		errs = append(errs, mismatchError(ErrCodeExpiryWindow, "expiry",
+			"at most "+p.MaxExpiry.String()+" after creation", window.String()+" after creation",
+			fmt.Sprintf("Expiry is more than %s after creation", p.MaxExpiry)))
+	}
+	if p.Author != "" && canary.Author != p.Author {
+		errs = append(errs, mismatchError(ErrCodeAuthor, "author", p.Author, canary.Author, "Author must be: "+p.Author))
+	}
+	for _, id := range p.Promises {
+		if _, ok := canary.Promise(id); !ok {
+			errs = append(errs, mismatchError(ErrCodeMissingPromise, "promises", id, "", "Required promise missing: "+id))
+		}
+	}
+	if p.DenyFinal && canary.Final {
+		errs = append(errs, validationError(ErrCodeFinalDenied, "final", "Final canaries are not allowed"))
+	}
+	return errs
+}
+
+/* Returns every violated rule on the link to the previous canary, including those of the policy
+ */
+
+func (p Policy) ValidatePrevious(new *Canary, old *Canary, oldProof string) ValidationErrors {
+	errs := new.ValidatePrevious(old, oldProof)
+	if old == nil {
+		return errs
+	}
+	interval := new.Creation.Time().Sub(old.Creation.Time())
+	if p.MinInterval > 0 && interval < p.MinInterval {
+		errs = append(errs, mismatchError(ErrCodeInterval, "creation",
+			"at least "+p.MinInterval.String()+" after current canary", interval.String()+" after current canary",
+			fmt.Sprintf("Canary created less than %s after current canary", p.MinInterval)))
+	}
+	return errs
+}
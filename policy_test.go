@@ -0,0 +1,54 @@
+package fugl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicy__Check(t *testing.T) {
+	now := time.Now()
+	oldProof := "old proof"
+	old := Canary{
+		Version:  CanaryVersion,
+		Author:   "John Doe",
+		Creation: CanaryTime(now.Add(-time.Hour)),
+		Expiry:   CanaryTime(now.Add(time.Hour)),
+		Nonce:    GetRandStr(CanaryNonceSize),
+	}
+	new := old
+	new.Creation = CanaryTime(now.Add(time.Minute)) // signer clock ahead
+	new.Expiry = CanaryTime(now.Add(48 * time.Hour))
+	new.Previous = HashString(oldProof)
+	new.Promises = []Promise{{ID: "no-warrants", Text: "We have not received any warrants"}}
+
+	if err := (Policy{}).Check(&new, &old, oldProof, now); err == nil {
+		t.Fatal("expected an error for creation in the future without clock skew")
+	}
+	policy := Policy{
+		MaxExpiry:   72 * time.Hour,
+		MinInterval: time.Hour,
+		ClockSkew:   5 * time.Minute,
+		Author:      "John Doe",
+		Promises:    []string{"no-warrants"},
+		DenyFinal:   true,
+	}
+	if err := policy.Check(&new, &old, oldProof, now); err != nil {
+		t.Fatalf("error checking canary against policy, err=%v", err)
+	}
+
+	violations := map[string]func(p *Policy, c *Canary){
+		"expiry window": func(p *Policy, c *Canary) { p.MaxExpiry = 24 * time.Hour },
+		"interval":      func(p *Policy, c *Canary) { p.MinInterval = 2 * time.Hour },
+		"clock skew":    func(p *Policy, c *Canary) { p.ClockSkew = time.Second },
+		"author":        func(p *Policy, c *Canary) { c.Author = "Jane Doe" },
+		"promise":       func(p *Policy, c *Canary) { c.Promises = nil },
+		"final":         func(p *Policy, c *Canary) { c.Final = true },
+	}
+	for name, violate := range violations {
+		p, c := policy, new
+		violate(&p, &c)
+		if err := p.Check(&c, &old, oldProof, now); err == nil {
+			t.Fatalf("expected an error violating %s", name)
+		}
+	}
+}
@@ -1,23 +1,70 @@
 package fugl
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"golang.org/x/crypto/openpgp"
 	"strings"
+	"time"
 )
 
-func OpenProof(entity *openpgp.Entity, proof string) (*Canary, string, error) {
-	// parse and verify signature
-	block, err := PGPVerify(entity, []byte(proof))
+/* An opened proof,
+ * along with the fingerprints of the keys which signed it
+ */
+
+type Proof struct {
+	Canary      *Canary
+	Description string
+	Signers     []string
+	Timestamp   *time.Time // time attested by a timestamp authority (if verified)
+}
+
+func OpenProof(verifier Verifier, proof string) (*Canary, string, error) {
+	opened, err := VerifyProof(verifier, proof)
 	if err != nil {
 		return nil, "", err
 	}
+	return opened.Canary, opened.Description, nil
+}
+
+func VerifyProof(verifier Verifier, proof string) (*Proof, error) {
+	return verifyProof(verifier, proof, false)
+}
+
+/* Like VerifyProof, but the proof must have the canonical layout (see strict.go),
+ * parse errors are of type *ProofParseError
+ */
+
+func VerifyProofStrict(verifier Verifier, proof string) (*Proof, error) {
+	return verifyProof(verifier, proof, true)
+}
+
+func verifyProof(verifier Verifier, proof string, strict bool) (*Proof, error) {
+	// parse and verify signatures
+	body, signers, err := verifier.Verify([]byte(proof))
+	if err != nil {
+		return nil, err
+	}
+	var canary *Canary
+	var description string
+	if strict {
+		canary, description, err = parseProofBodyStrict(body)
+	} else {
+		canary, description, err = parseProofBody(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Proof{
+		Canary:      canary,
+		Description: description,
+		Signers:     signers,
+	}, nil
+}
 
+func parseProofBody(body []byte) (*Canary, string, error) {
 	// scan for seperator
 	start := 0
-	lines := strings.Split(string(block.Bytes), "\n")
+	lines := strings.Split(string(body), "\n")
 	for ; start < len(lines); start++ {
 		if strings.TrimRight(lines[start], "\n\r") == CANARY_SEPERATOR {
 			break
@@ -27,8 +74,10 @@ func OpenProof(entity *openpgp.Entity, proof string) (*Canary, string, error) {
 		return nil, "", errors.New("Unable to find canary seperator")
 	}
 
+	// description precedes the seperator (excluding empty lines)
+	des := strings.TrimRight(strings.Join(lines[:start], "\n"), "\r\n")
+
 	// eat seperator and empty lines
-	des := strings.Join(lines[:start-1], "\n")
 	for start = start + 1; start < len(lines); start++ {
 		if strings.TrimRight(lines[start], "\n\r") != "" {
 			break
@@ -36,28 +85,38 @@ func OpenProof(entity *openpgp.Entity, proof string) (*Canary, string, error) {
 	}
 
 	// load JSON structure
-	var canary Canary
 	ser := strings.Join(lines[start:], "\n")
-	err = json.Unmarshal([]byte(ser), &canary)
+	canary, err := ParseCanary([]byte(ser))
 	if err != nil {
-		return nil, "", errors.New("Unable to parse json structure")
+		return nil, "", errors.New("Unable to parse canary: " + err.Error())
 	}
-	return &canary, des, nil
+	return canary, des, nil
 }
 
-func SealProof(entity *openpgp.Entity, canary Canary, description string) (string, error) {
+func SealProof(signer Signer, canary Canary, description string) (string, error) {
 	// serialize canary
-	ser, err := json.MarshalIndent(canary, "", "    ")
+	ser, err := SerializeCanary(canary)
 	if err != nil {
 		return "", err
 	}
 
-	// add serperator and sign
+	// description must not be confused with the seperator
+	description = strings.TrimRight(description, "\n")
+	if strings.ContainsRune(description, '\r') {
+		return "", errors.New("Description must not contain carriage returns")
+	}
+	for _, line := range strings.Split(description, "\n") {
+		if strings.TrimSpace(line) == CANARY_SEPERATOR {
+			return "", errors.New("Description must not contain the canary seperator")
+		}
+	}
+
+	// add serperator and sign (canonical layout)
 	var inner string
 	if description == "" {
-		inner = fmt.Sprintf("%s\n%s", CANARY_SEPERATOR, string(ser))
+		inner = fmt.Sprintf("%s\n\n%s", CANARY_SEPERATOR, string(ser))
 	} else {
-		inner = fmt.Sprintf("%s\n%s\n\n%s", description, CANARY_SEPERATOR, string(ser))
+		inner = fmt.Sprintf("%s\n\n%s\n\n%s", description, CANARY_SEPERATOR, string(ser))
 	}
-	return PGPSign(entity, []byte(inner))
+	return signer.Sign([]byte(inner))
 }
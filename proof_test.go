@@ -0,0 +1,142 @@
+package fugl
+
+import (
+	"encoding/json"
+	"golang.org/x/crypto/openpgp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProof__SealAndOpen(t *testing.T) {
+	pgpPub, _ := PGPLoadPublicKey([]byte(pair.public))
+	pgpPriv, _ := PGPLoadPrivateKey([]byte(pair.private))
+	edPubs, edPrivs := newEd25519Keys(t, 1)
+
+	backends := []struct {
+		name     string
+		signer   Signer
+		verifier Verifier
+	}{
+		{BackendPGP, PGPSigner{Keys: []*openpgp.Entity{pgpPriv}}, PGPVerifier{Keyring: openpgp.EntityList{pgpPub}}},
+		{BackendEd25519, Ed25519Signer{Keys: edPrivs}, Ed25519Verifier{Keys: edPubs}},
+	}
+
+	canary := Canary{
+		Version:  CanaryVersion,
+		Author:   "John Doe",
+		Creation: CanaryTime(time.Now()),
+		Expiry:   CanaryTime(time.Now().Add(time.Hour)),
+		Nonce:    GetRandStr(CanaryNonceSize),
+	}
+	for _, backend := range backends {
+		proof, err := SealProof(backend.signer, canary, "# Test canary\n\ndescription")
+		if err != nil {
+			t.Fatalf("%s: error sealing proof, err=%v", backend.name, err)
+		}
+		opened, err := VerifyProof(backend.verifier, proof)
+		if err != nil {
+			t.Fatalf("%s: error opening proof, err=%v", backend.name, err)
+		}
+		if !canary.Equal(*opened.Canary) {
+			t.Fatalf("%s: opened canary does not match sealed canary", backend.name)
+		}
+		if len(opened.Signers) != 1 {
+			t.Fatalf("%s: expected one signer, got %v", backend.name, opened.Signers)
+		}
+		strict, err := VerifyProofStrict(backend.verifier, proof)
+		if err != nil {
+			t.Fatalf("%s: error opening sealed proof in strict mode, err=%v", backend.name, err)
+		}
+		if strict.Description != "# Test canary\n\ndescription" {
+			t.Fatalf("%s: unexpected description: %q", backend.name, strict.Description)
+		}
+	}
+}
+
+func TestProof__ParseDescription(t *testing.T) {
+	canary := Canary{
+		Version:  CanaryVersion,
+		Author:   "John Doe",
+		Creation: CanaryTime(time.Now()),
+		Expiry:   CanaryTime(time.Now().Add(time.Hour)),
+		Nonce:    GetRandStr(CanaryNonceSize),
+	}
+	ser, _ := SerializeCanary(canary)
+
+	bodies := map[string]string{
+		"":                      CANARY_SEPERATOR + "\n\n" + string(ser),
+		"# Test\n\ndescription": "# Test\n\ndescription\n\n" + CANARY_SEPERATOR + "\n\n" + string(ser),
+		"# Test\n\nlast line":   "# Test\n\nlast line\n" + CANARY_SEPERATOR + "\n" + string(ser),
+		"first line\nlast line": "first line\nlast line\n\n\n" + CANARY_SEPERATOR + "\n\n\n" + string(ser),
+	}
+	for expected, body := range bodies {
+		_, description, err := parseProofBody([]byte(body))
+		if err != nil {
+			t.Fatalf("error parsing proof body, err=%v", err)
+		}
+		if description != expected {
+			t.Fatalf("expected description %q, got %q", expected, description)
+		}
+	}
+}
+
+func TestProof__ParseStrict(t *testing.T) {
+	canary := Canary{
+		Version:  CanaryVersion,
+		Author:   "John Doe",
+		Creation: CanaryTime(time.Now()),
+		Expiry:   CanaryTime(time.Now().Add(time.Hour)),
+		Nonce:    GetRandStr(CanaryNonceSize),
+	}
+	ser, _ := SerializeCanary(canary)
+	meta := CANARY_SEPERATOR + "\n\n" + string(ser)
+
+	// canonical layouts
+	for _, body := range []string{meta, "# Test\n\ndescription\n\n" + meta} {
+		opened, _, err := parseProofBodyStrict([]byte(body))
+		if err != nil {
+			t.Fatalf("error parsing canonical proof, err=%v", err)
+		}
+		if !canary.Equal(*opened) {
+			t.Fatal("parsed canary does not match serialized canary")
+		}
+	}
+
+	// rejected layouts, along with the offending line
+	author := strings.Replace(string(ser), `"author": "John Doe",`, `"author": "John Doe",`+"\n"+`    "author": "Jane Doe",`, 1)
+	unknown := strings.Replace(string(ser), `"author": "John Doe",`, `"author": "John Doe",`+"\n"+`    "extra": 1,`, 1)
+	folded := strings.Replace(string(ser), `"author": "John Doe",`, `"author": "John Doe",`+"\n"+`    "Author": "Jane Doe",`, 1)
+	compact, _ := json.Marshal(canary)
+	bodies := []struct {
+		body string
+		line int
+	}{
+		{"description\n" + meta, 1},
+		{"description\n\n\n" + meta, 2},
+		{"\n" + meta, 1},
+		{CANARY_SEPERATOR + "\n" + string(ser), 2},
+		{CANARY_SEPERATOR + "\n\n\n" + string(ser), 3},
+		{"description\n\n" + meta + "\n" + meta, 15},
+		{"description\n\n" + CANARY_SEPERATOR + " \n\n" + string(ser), 3},
+		{"description\r\n\n" + meta, 1},
+		{meta + "\n", 12},
+		{meta + "\n{}", 12},
+		{CANARY_SEPERATOR + "\n\n" + author, 6},
+		{CANARY_SEPERATOR + "\n\n" + unknown, 6},
+		{CANARY_SEPERATOR + "\n\n" + folded, 6},
+		{CANARY_SEPERATOR + "\n\n" + string(compact), 3},
+		{CANARY_SEPERATOR + "\n\n" + string(ser[:len(ser)-2]), 11},
+		{"description", 0},
+	}
+	for i, test := range bodies {
+		_, _, err := parseProofBodyStrict([]byte(test.body))
+		parseErr, ok := err.(*ProofParseError)
+		if !ok {
+			t.Fatalf("%d: expected a parse error, got %v", i, err)
+		}
+		if parseErr.Line != test.line {
+			t.Fatalf("%d: expected error on line %d, got: %v", i, test.line, parseErr)
+		}
+	}
+}
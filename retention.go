@@ -0,0 +1,337 @@
+package fugl
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+/* Retention of stored proofs:
+ * proofs not retained by the policy are moved from the store into a compressed archive (bundle),
+ * a tar.gz file holding the proofs (and timestamps) along with a manifest of their hashes.
+ *
+ * The archived proofs remain part of the chain,
+ * given the archives CheckStore verifies the chain across the archived proofs.
+ */
+
+const (
+	ArchiveFileExtension = ".tar.gz"
+	ArchiveFileName      = "archive-%s" + ArchiveFileExtension
+	ArchiveManifestName  = "manifest.json"
+	ArchiveMaxFileSize   = 1 << 24
+)
+
+type RetentionPolicy struct {
+	KeepLast    int           // keep the newest proofs
+	KeepWithin  time.Duration // keep proofs expiring within this duration before now (or later)
+	KeepMonthly bool          // keep the newest proof expiring in every month (checkpoints)
+}
+
+/* Stores from which proofs can be removed
+ */
+
+type DeleteStore interface {
+	Delete(hash string) error // removes the proof (and timestamp) with the given hash
+}
+
+type ArchiveEntry struct {
+	Hash     string     `json:"hash"`
+	Previous string     `json:"previous,omitempty"`
+	Expiry   CanaryTime `json:"expiry"`
+	File     string     `json:"file"`
+}
+
+type ArchiveManifest struct {
+	Created CanaryTime     `json:"created"`
+	Proofs  []ArchiveEntry `json:"proofs"` // oldest first
+}
+
+type Archive struct {
+	Manifest ArchiveManifest
+	Proofs   map[string]string // hash -> proof
+}
+
+func (policy RetentionPolicy) Enabled() bool {
+	return policy.KeepLast > 0 || policy.KeepWithin > 0 || policy.KeepMonthly
+}
+
+/* Selects which of the canaries (oldest first) are retained.
+ * The newest canary and canaries announcing a key rotation are always retained,
+ * so the keys can be followed from the oldest proof.
+ */
+
+func (policy RetentionPolicy) Retain(canaries []*Canary, now time.Time) []bool {
+	retain := make([]bool, len(canaries))
+	if !policy.Enabled() {
+		for i := range retain {
+			retain[i] = true
+		}
+		return retain
+	}
+	for i, canary := range canaries {
+		expiry := canary.Expiry.Time().UTC()
+		switch {
+		case i == len(canaries)-1:
+			retain[i] = true
+		case canary.Rotation != nil:
+			retain[i] = true
+		case i >= len(canaries)-policy.KeepLast:
+			retain[i] = true
+		case policy.KeepWithin > 0 && !expiry.Before(now.Add(-policy.KeepWithin)):
+			retain[i] = true
+		case policy.KeepMonthly:
+			next := canaries[i+1].Expiry.Time().UTC()
+			retain[i] = expiry.Year() != next.Year() || expiry.Month() != next.Month()
+		}
+	}
+	return retain
+}
+
+/* Moves the proofs not retained by the policy into a new archive in dir,
+ * returning the path of the archive (empty if nothing was archived) and the number of proofs archived.
+ *
+ * The proofs must verify (see CheckStore) and the archive is written before any proof is removed.
+ */
+
+func ArchiveStore(store Store, verifier Verifier, policy RetentionPolicy, dir string, now time.Time) (string, int, error) {
+	deletes, ok := store.(DeleteStore)
+	if !ok {
+		return "", 0, errors.New("Store does not support removing proofs")
+	}
+	pending, err := PrepareArchive(store, verifier, policy, now)
+	if err != nil || pending == nil {
+		return "", 0, err
+	}
+	name, err := pending.Write(dir)
+	if err != nil {
+		return "", 0, err
+	}
+	count, err := pending.Remove(deletes)
+	return name, count, err
+}
+
+/* An archive built from the store, but not yet written (nor the proofs removed).
+ *
+ * Building the archive (verifying every proof) only reads the store,
+ * allowing callers to hold a lock on the store only while removing the proofs.
+ */
+
+type PendingArchive struct {
+	Manifest ArchiveManifest
+	bundle   []byte
+}
+
+// returns nil if no proofs are to be archived
+func PrepareArchive(store Store, verifier Verifier, policy RetentionPolicy, now time.Time) (*PendingArchive, error) {
+	proofs, err := store.List(time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	canaries := make([]*Canary, len(proofs))
+	for i, proof := range proofs {
+		opened, err := VerifyProof(verifier, proof)
+		if err != nil {
+			return nil, errors.New("Unable to verify stored proof (check the store): " + err.Error())
+		}
+		canaries[i] = opened.Canary
+		verifier, err = verifier.Rotate(opened.Canary.Rotation)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// build the archive
+	manifest := ArchiveManifest{Created: CanaryTime(now)}
+	files := make(map[string][]byte)
+	timestamps, _ := store.(TimestampStore)
+	for i, retain := range policy.Retain(canaries, now) {
+		if retain {
+			continue
+		}
+		hash := HashString(proofs[i])
+		name := fmt.Sprintf(ProofFileName, canaries[i].Expiry.Time().UTC().Format(ProofFileTimeFormat), hash)
+		manifest.Proofs = append(manifest.Proofs, ArchiveEntry{
+			Hash:     hash,
+			Previous: canaries[i].Previous,
+			Expiry:   canaries[i].Expiry,
+			File:     name,
+		})
+		files[name] = []byte(proofs[i])
+		if timestamps != nil {
+			token, err := timestamps.Timestamp(hash)
+			if err != nil {
+				return nil, err
+			}
+			if token != nil {
+				files[name+TimestampFileExtension] = token
+			}
+		}
+	}
+	if len(manifest.Proofs) == 0 {
+		return nil, nil
+	}
+	bundle, err := writeArchive(manifest, files)
+	if err != nil {
+		return nil, err
+	}
+	return &PendingArchive{Manifest: manifest, bundle: bundle}, nil
+}
+
+// writes the archive to dir, returning the path of the archive
+func (pending *PendingArchive) Write(dir string) (string, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	name := path.Join(dir, fmt.Sprintf(ArchiveFileName, pending.Manifest.Created.Time().UTC().Format(ProofFileTimeFormat)))
+	if _, err := os.Stat(name); err == nil {
+		return "", errors.New("Archive already exists: " + name)
+	}
+	if err := writeFileAtomic(name, pending.bundle, 0600); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// removes the archived proofs from the store (after writing the archive), returning the number removed
+func (pending *PendingArchive) Remove(store DeleteStore) (int, error) {
+	for i, entry := range pending.Manifest.Proofs {
+		if err := store.Delete(entry.Hash); err != nil {
+			return i, err
+		}
+	}
+	return len(pending.Manifest.Proofs), nil
+}
+
+func writeArchive(manifest ArchiveManifest, files map[string][]byte) ([]byte, error) {
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// manifest first, followed by the files in lexical order
+	var buf bytes.Buffer
+	compressed := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(compressed)
+	write := func(name string, data []byte) error {
+		err := archive.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(data)),
+			ModTime: manifest.Created.Time(),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = archive.Write(data)
+		return err
+	}
+	if err := write(ArchiveManifestName, encoded); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if err := write(name, files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	if err := compressed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/* Reads an archive, checking that every proof in the manifest is present and matches its hash
+ */
+
+func ReadArchive(r io.Reader) (*Archive, error) {
+	decompressed, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	reader := tar.NewReader(decompressed)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(reader, ArchiveMaxFileSize))
+		if err != nil {
+			return nil, err
+		}
+		files[header.Name] = data
+	}
+	encoded, ok := files[ArchiveManifestName]
+	if !ok {
+		return nil, errors.New("Archive has no manifest")
+	}
+	archive := &Archive{Proofs: make(map[string]string)}
+	if err := json.Unmarshal(encoded, &archive.Manifest); err != nil {
+		return nil, errors.New("Invalid archive manifest: " + err.Error())
+	}
+	for _, entry := range archive.Manifest.Proofs {
+		name := fmt.Sprintf(ProofFileName, entry.Expiry.Time().UTC().Format(ProofFileTimeFormat), entry.Hash)
+		if entry.File != name {
+			return nil, errors.New("Invalid file name in archive manifest: " + entry.File)
+		}
+		proof, ok := files[entry.File]
+		if !ok {
+			return nil, errors.New("Archive is missing proof: " + entry.File)
+		}
+		if HashString(string(proof)) != entry.Hash {
+			return nil, errors.New("Archived proof does not match hash in manifest: " + entry.File)
+		}
+		archive.Proofs[entry.Hash] = string(proof)
+	}
+	return archive, nil
+}
+
+/* Reads every archive in dir (oldest first), a missing directory holds no archives
+ */
+
+func LoadArchives(dir string) ([]*Archive, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var archives []*Archive
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ArchiveFileExtension) {
+			continue
+		}
+		handle, err := os.Open(path.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		archive, err := ReadArchive(handle)
+		handle.Close()
+		if err != nil {
+			return nil, errors.New(file.Name() + ": " + err.Error())
+		}
+		archives = append(archives, archive)
+	}
+	return archives, nil
+}
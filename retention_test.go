@@ -0,0 +1,123 @@
+package fugl
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestRetention__Archive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fugl-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, _ := NewDirectoryStore(dir + "/proofs")
+
+	// proofs expiring every 10 days, rotating the key in the second
+	pubs, privs := newEd25519Keys(t, 2)
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	var proofs []string
+	for i := 0; i < 8; i++ {
+		canary := Canary{
+			Version:  CanaryVersion,
+			Author:   "John Doe",
+			Creation: CanaryTime(start.Add(time.Duration(10*i-1) * 24 * time.Hour)),
+			Expiry:   CanaryTime(start.Add(time.Duration(10*i) * 24 * time.Hour)),
+			Nonce:    GetRandStr(CanaryNonceSize),
+		}
+		if i > 0 {
+			canary.Previous = HashString(proofs[i-1])
+		}
+		signer := Ed25519Signer{Keys: privs[1:]}
+		if i < 2 {
+			signer = Ed25519Signer{Keys: privs[:1]}
+		}
+		if i == 1 {
+			canary.Rotation = Ed25519KeyRotation(pubs[0], pubs[1])
+		}
+		proof, err := SealProof(signer, canary, "")
+		if err != nil {
+			t.Fatalf("error sealing proof, err=%v", err)
+		}
+		store.Save(proof, &canary)
+		store.SaveTimestamp(HashString(proof), []byte("token"))
+		proofs = append(proofs, proof)
+	}
+
+	// retains the rotation, the last proof of every month and the last two
+	policy := RetentionPolicy{KeepLast: 2, KeepMonthly: true}
+	now := time.Date(2017, 3, 13, 0, 0, 0, 0, time.UTC)
+
+	// preparing the archive leaves the store untouched
+	pending, err := PrepareArchive(store, Ed25519Verifier{Keys: pubs[:1]}, policy, now)
+	if err != nil || len(pending.Manifest.Proofs) != 3 {
+		t.Fatalf("expected 3 proofs to archive (err=%v)", err)
+	}
+	if count, _ := store.Count(); count != len(proofs) {
+		t.Fatalf("expected %d proofs stored, got %d", len(proofs), count)
+	}
+	name, count, err := ArchiveStore(store, Ed25519Verifier{Keys: pubs[:1]}, policy, dir+"/archive", now)
+	if err != nil || count != 3 {
+		t.Fatalf("expected 3 proofs archived, got %d (err=%v)", count, err)
+	}
+	if path.Dir(name) != dir+"/archive" {
+		t.Fatalf("unexpected archive: %s", name)
+	}
+	stored, _ := store.List(time.Time{}, time.Time{})
+	retained := []int{1, 3, 5, 6, 7}
+	if len(stored) != len(retained) {
+		t.Fatalf("expected %d proofs retained, got %d", len(retained), len(stored))
+	}
+	for i, j := range retained {
+		if stored[i] != proofs[j] {
+			t.Fatalf("expected proof %d retained", j)
+		}
+	}
+
+	archives, err := LoadArchives(dir + "/archive")
+	if err != nil || len(archives) != 1 {
+		t.Fatalf("expected a single archive, err=%v", err)
+	}
+	for _, i := range []int{0, 2, 4} {
+		if archives[0].Proofs[HashString(proofs[i])] != proofs[i] {
+			t.Fatalf("expected proof %d archived", i)
+		}
+	}
+
+	// the chain is continuous given the archive
+	report, err := CheckStore(store, Ed25519Verifier{Keys: pubs[:1]})
+	if err != nil || len(report.Issues) != 2 || report.Issues[0].Kind != StoreIssueGap {
+		t.Fatalf("expected gaps without the archive, got %v (err=%v)", report.Issues, err)
+	}
+	report, err = CheckStore(store, Ed25519Verifier{Keys: pubs[:1]}, archives...)
+	if err != nil || len(report.Issues) != 0 || len(report.Chain) != len(retained) {
+		t.Fatalf("expected no issues with the archive, got %v (err=%v)", report.Issues, err)
+	}
+
+	// nothing more to archive
+	if _, count, err := ArchiveStore(store, Ed25519Verifier{Keys: pubs[:1]}, policy, dir+"/archive", now); err != nil || count != 0 {
+		t.Fatalf("expected nothing archived, got %d (err=%v)", count, err)
+	}
+}
+
+func TestRetention__Within(t *testing.T) {
+	now := time.Now()
+	var canaries []*Canary
+	for i := 5; i >= 0; i-- {
+		canaries = append(canaries, &Canary{Expiry: CanaryTime(now.Add(-time.Duration(i) * time.Hour))})
+	}
+	retain := RetentionPolicy{KeepWithin: 150 * time.Minute}.Retain(canaries, now)
+	for i, expected := range []bool{false, false, false, true, true, true} {
+		if retain[i] != expected {
+			t.Fatalf("unexpected retention %v", retain)
+		}
+	}
+	for _, keep := range (RetentionPolicy{}).Retain(canaries, now) {
+		if !keep {
+			t.Fatal("expected everything retained without a policy")
+		}
+	}
+}
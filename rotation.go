@@ -0,0 +1,85 @@
+package fugl
+
+import (
+	"errors"
+	"golang.org/x/crypto/openpgp"
+	"strings"
+)
+
+/* A canary may announce the rotation of a signing key,
+ * after which proofs must be signed by the next key and the retired key is no longer accepted.
+ *
+ * The next key is included in the canary, hence the rotation is covered by the signatures
+ * of the current keys and can be followed by anyone holding the chain.
+ */
+
+type KeyRotation struct {
+	Retire string `json:"retire"` // Fingerprint of the key being retired
+	Next   string `json:"next"`   // Fingerprint of the next key
+	Key    string `json:"key"`    // Armored next public key (format depends on backend)
+}
+
+func (r KeyRotation) check() error {
+	if r.Retire == "" || r.Next == "" || r.Key == "" {
+		return errors.New("Key rotation must specify retired fingerprint, next fingerprint and next key")
+	}
+	if strings.EqualFold(r.Retire, r.Next) {
+		return errors.New("Key rotation must replace the retired key")
+	}
+	return nil
+}
+
+func PGPKeyRotation(retire *openpgp.Entity, next *openpgp.Entity) (*KeyRotation, error) {
+	if retire == nil || next == nil {
+		return nil, errors.New("invalid public key")
+	}
+	key, err := PGPArmorPublicKey(next)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyRotation{
+		Retire: PGPFingerprint(retire),
+		Next:   PGPFingerprint(next),
+		Key:    key,
+	}, nil
+}
+
+func (r KeyRotation) PGPNextKey() (*openpgp.Entity, error) {
+	entity, err := PGPLoadPublicKey([]byte(r.Key))
+	if err != nil {
+		return nil, errors.New("Unable to parse next key: " + err.Error())
+	}
+	if !strings.EqualFold(PGPFingerprint(entity), r.Next) {
+		return nil, errors.New("Next key does not match fingerprint")
+	}
+	return entity, nil
+}
+
+func RotateKeyring(keyring openpgp.EntityList, rotation *KeyRotation) (openpgp.EntityList, error) {
+	if rotation == nil {
+		return keyring, nil
+	}
+	next, err := rotation.PGPNextKey()
+	if err != nil {
+		return nil, err
+	}
+
+	// replace retired key
+	retired := false
+	rotated := make(openpgp.EntityList, 0, len(keyring))
+	for _, entity := range keyring {
+		fingerprint := PGPFingerprint(entity)
+		if strings.EqualFold(fingerprint, rotation.Next) {
+			return nil, errors.New("Next key is already in use")
+		}
+		if strings.EqualFold(fingerprint, rotation.Retire) {
+			retired = true
+			continue
+		}
+		rotated = append(rotated, entity)
+	}
+	if !retired {
+		return nil, errors.New("Retired key is not in use")
+	}
+	return append(rotated, next), nil
+}
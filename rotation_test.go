@@ -0,0 +1,62 @@
+package fugl
+
+import (
+	"golang.org/x/crypto/openpgp"
+	"testing"
+)
+
+func TestRotation__RotateKeyring(t *testing.T) {
+	next, err := newKeypair()
+	if err != nil {
+		t.Fatalf("error creating pgp keys, err=%v", err)
+	}
+	currentPub, _ := PGPLoadPublicKey([]byte(pair.public))
+	currentPriv, _ := PGPLoadPrivateKey([]byte(pair.private))
+	nextPub, _ := PGPLoadPublicKey([]byte(next.public))
+	nextPriv, _ := PGPLoadPrivateKey([]byte(next.private))
+
+	rotation, err := PGPKeyRotation(currentPub, nextPub)
+	if err != nil {
+		t.Fatalf("error creating key rotation, err=%v", err)
+	}
+	keyring, err := RotateKeyring(openpgp.EntityList{currentPub}, rotation)
+	if err != nil {
+		t.Fatalf("error rotating keyring, err=%v", err)
+	}
+	if len(keyring) != 1 || PGPFingerprint(keyring[0]) != rotation.Next {
+		t.Fatal("keyring does not contain only the next key")
+	}
+
+	// the retired key is no longer accepted
+	message := []byte("this is a test message")
+	sig, _ := PGPSign(currentPriv, message)
+	if _, _, err := PGPVerifyThreshold(keyring, 1, []byte(sig)); err == nil {
+		t.Fatal("expected an error verifying signature by retired key")
+	}
+	sig, _ = PGPSign(nextPriv, message)
+	if _, _, err := PGPVerifyThreshold(keyring, 1, []byte(sig)); err != nil {
+		t.Fatalf("error verifying signature by next key, err=%v", err)
+	}
+
+	// rotation must retire a key in use
+	if _, err := RotateKeyring(keyring, rotation); err == nil {
+		t.Fatal("expected an error rotating a key not in use")
+	}
+}
+
+func TestRotation__FingerprintMismatch(t *testing.T) {
+	pub, _ := PGPLoadPublicKey([]byte(pair.public))
+	rotation, err := PGPKeyRotation(pub, pub)
+	if err != nil {
+		t.Fatalf("error creating key rotation, err=%v", err)
+	}
+	rotation.Next = rotation.Retire[1:] + "0"
+	if _, err := rotation.PGPNextKey(); err == nil {
+		t.Fatal("expected an error when fingerprint does not match key")
+	}
+
+	canary := Canary{Version: 0, Rotation: rotation}
+	if _, err := SerializeCanary(canary); err == nil {
+		t.Fatal("expected an error serializing key rotation as version 0")
+	}
+}
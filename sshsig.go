@@ -0,0 +1,373 @@
+package fugl
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"strings"
+)
+
+/* OpenSSH signature backend (PROTOCOL.sshsig)
+ *
+ * The message is followed by one armored SSH signature per signer,
+ * created in the "fugl" namespace and verified against an allowed_signers file.
+ * Each signature can also be checked using:
+ *
+ *   ssh-keygen -Y verify -n fugl -f allowed_signers -I <principal> -s <signature>
+ */
+
+const (
+	SSHSignatureNamespace = "fugl"
+	SSHSignatureType      = "SSH SIGNATURE"
+	sshsigMagic           = "SSHSIG"
+	sshsigVersion         = 1
+	sshsigHash            = "sha512"
+)
+
+type SSHAllowedSigner struct {
+	Principals []string      // identities of the signer
+	Key        ssh.PublicKey // public key of the signer
+}
+
+type sshsigBlob struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+func sshsigSignedData(namespace string, hashAlgorithm string, message []byte) ([]byte, error) {
+	var hash []byte
+	switch hashAlgorithm {
+	case "sha512":
+		sum := sha512.Sum512(message)
+		hash = sum[:]
+	case "sha256":
+		sum := sha256.Sum256(message)
+		hash = sum[:]
+	default:
+		return nil, errors.New("Unsupported signature hash algorithm")
+	}
+	data := ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{namespace, "", hashAlgorithm, hash})
+	return append([]byte(sshsigMagic), data...), nil
+}
+
+func SSHFingerprint(key ssh.PublicKey) string {
+	return ssh.FingerprintSHA256(key)
+}
+
+func SSHLoadPrivateKey(key []byte, passphrase []byte) (ssh.Signer, error) {
+	if passphrase == nil {
+		return ssh.ParsePrivateKey(key)
+	}
+	return ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
+}
+
+/* Parses an allowed_signers file (see ssh-keygen(1)),
+ * the only option supported is "namespaces", which must include "fugl"
+ */
+
+func SSHLoadAllowedSigners(data []byte) ([]SSHAllowedSigner, error) {
+	var signers []SSHAllowedSigner
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		split := strings.IndexAny(line, " \t")
+		if split < 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid allowed signer on line %d", n+1))
+		}
+		principals := line[:split]
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(line[split+1:]))
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid allowed signer on line %d: %s", n+1, err.Error()))
+		}
+		for _, option := range options {
+			if !strings.HasPrefix(strings.ToLower(option), "namespaces=") {
+				return nil, errors.New(fmt.Sprintf("Unsupported option on line %d: %s", n+1, option))
+			}
+			namespaces := strings.Trim(option[len("namespaces="):], "\"")
+			allowed := false
+			for _, namespace := range strings.Split(namespaces, ",") {
+				allowed = allowed || namespace == SSHSignatureNamespace
+			}
+			if !allowed {
+				key = nil
+			}
+		}
+		if key != nil {
+			signers = append(signers, SSHAllowedSigner{
+				Principals: strings.Split(principals, ","),
+				Key:        key,
+			})
+		}
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("No allowed signers found")
+	}
+	return signers, nil
+}
+
+func SSHSign(signers []ssh.Signer, message []byte) (string, error) {
+	if bytes.Contains(message, []byte("-----BEGIN "+SSHSignatureType)) {
+		return "", errors.New("Message contains signature marker")
+	}
+	blocks, err := sshsigBlocks(signers, message, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(message) + "\n" + blocks, nil
+}
+
+// creates an armored signature for every signer, refusing keys in existing (marshaled public keys)
+func sshsigBlocks(signers []ssh.Signer, message []byte, existing [][]byte) (string, error) {
+	if len(signers) == 0 {
+		return "", errors.New("no private keys supplied")
+	}
+	signed, err := sshsigSignedData(SSHSignatureNamespace, sshsigHash, message)
+	if err != nil {
+		return "", err
+	}
+	var blocks string
+	for _, signer := range signers {
+		if signer == nil {
+			return "", errors.New("invalid private key")
+		}
+		for _, key := range existing {
+			if bytes.Equal(key, signer.PublicKey().Marshal()) {
+				return "", errors.New("Proof already signed by: " + SSHFingerprint(signer.PublicKey()))
+			}
+		}
+		var sig *ssh.Signature
+		algorithmSigner, ok := signer.(ssh.AlgorithmSigner)
+		if ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+			sig, err = algorithmSigner.SignWithAlgorithm(rand.Reader, signed, ssh.SigAlgoRSASHA2512)
+		} else {
+			sig, err = signer.Sign(rand.Reader, signed)
+		}
+		if err != nil {
+			return "", err
+		}
+		blob := ssh.Marshal(sshsigBlob{
+			Version:       sshsigVersion,
+			PublicKey:     signer.PublicKey().Marshal(),
+			Namespace:     SSHSignatureNamespace,
+			HashAlgorithm: sshsigHash,
+			Signature:     ssh.Marshal(sig),
+		})
+		block := &pem.Block{Type: SSHSignatureType, Bytes: append([]byte(sshsigMagic), blob...)}
+		blocks += string(pem.EncodeToMemory(block))
+	}
+	return blocks, nil
+}
+
+/* Adds an armored signature by every signer to the proof,
+ * keeping the existing signatures (e.g. of officers signing separately)
+ */
+
+func SSHCosign(signers []ssh.Signer, proof []byte) (string, error) {
+	message, rest, err := sshsigSplitProof(proof)
+	if err != nil {
+		return "", err
+	}
+
+	// public keys of the existing signatures
+	var existing [][]byte
+	for len(bytes.TrimSpace(rest)) > 0 {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil || block.Type != SSHSignatureType || !bytes.HasPrefix(block.Bytes, []byte(sshsigMagic)) {
+			return "", errors.New("Proof contains junk")
+		}
+		var blob sshsigBlob
+		err := ssh.Unmarshal(block.Bytes[len(sshsigMagic):], &blob)
+		if err != nil {
+			return "", err
+		}
+		existing = append(existing, blob.PublicKey)
+	}
+	blocks, err := sshsigBlocks(signers, message, existing)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(proof), "\n") + "\n" + blocks, nil
+}
+
+// splits the proof into the message and the armored signatures
+func sshsigSplitProof(proof []byte) ([]byte, []byte, error) {
+	marker := []byte("\n-----BEGIN " + SSHSignatureType + "-----")
+	index := bytes.Index(proof, marker)
+	if index < 0 {
+		return nil, nil, errors.New("Unable to find signature block")
+	}
+	return proof[:index], proof[index+1:], nil
+}
+
+func sshsigVerify(signers []SSHAllowedSigner, message []byte, data []byte) (ssh.PublicKey, error) {
+	// parse signature blob
+	if !bytes.HasPrefix(data, []byte(sshsigMagic)) {
+		return nil, errors.New("Invalid signature preamble")
+	}
+	var blob sshsigBlob
+	err := ssh.Unmarshal(data[len(sshsigMagic):], &blob)
+	if err != nil {
+		return nil, err
+	}
+	if blob.Version != sshsigVersion {
+		return nil, errors.New("Unsupported signature version")
+	}
+	if blob.Namespace != SSHSignatureNamespace {
+		return nil, errors.New("Signature not in namespace: " + SSHSignatureNamespace)
+	}
+	var sig ssh.Signature
+	err = ssh.Unmarshal(blob.Signature, &sig)
+	if err != nil {
+		return nil, err
+	}
+	if sig.Format == ssh.KeyAlgoRSA {
+		return nil, errors.New("RSA signatures must use SHA-2")
+	}
+
+	// find allowed signer and verify
+	var key ssh.PublicKey
+	for _, signer := range signers {
+		if bytes.Equal(signer.Key.Marshal(), blob.PublicKey) {
+			key = signer.Key
+		}
+	}
+	if key == nil {
+		return nil, errors.New("Signer not allowed")
+	}
+	signed, err := sshsigSignedData(blob.Namespace, blob.HashAlgorithm, message)
+	if err != nil {
+		return nil, err
+	}
+	return key, key.Verify(signed, &sig)
+}
+
+func SSHVerify(signers []SSHAllowedSigner, threshold int, proof []byte) ([]byte, []string, error) {
+	if len(signers) == 0 {
+		return nil, nil, errors.New("invalid public key")
+	}
+	if threshold < 1 || threshold > len(signers) {
+		return nil, nil, errors.New("Invalid signature threshold")
+	}
+
+	// split message and signatures
+	message, rest, err := sshsigSplitProof(proof)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// verify signatures one at a time
+	var fingerprints []string
+	seen := make(map[string]bool)
+	for len(bytes.TrimSpace(rest)) > 0 {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil || block.Type != SSHSignatureType {
+			return nil, nil, errors.New("Proof contains junk")
+		}
+		key, err := sshsigVerify(signers, message, block.Bytes)
+		if err != nil {
+			return nil, nil, errors.New("Invalid signature")
+		}
+		fingerprint := SSHFingerprint(key)
+		if !seen[fingerprint] {
+			seen[fingerprint] = true
+			fingerprints = append(fingerprints, fingerprint)
+		}
+	}
+	if len(fingerprints) < threshold {
+		return nil, nil, errors.New(fmt.Sprintf("Signed by %d keys, %d required", len(fingerprints), threshold))
+	}
+	return message, fingerprints, nil
+}
+
+func SSHKeyRotation(retire ssh.PublicKey, next ssh.PublicKey) *KeyRotation {
+	return &KeyRotation{
+		Retire: SSHFingerprint(retire),
+		Next:   SSHFingerprint(next),
+		Key:    strings.TrimSpace(string(ssh.MarshalAuthorizedKey(next))),
+	}
+}
+
+type SSHSigner struct {
+	Keys []ssh.Signer // private keys, each producing a signature
+}
+
+type SSHVerifier struct {
+	Signers   []SSHAllowedSigner // allowed signers
+	Threshold int                // number of signatures required (0 is treated as 1)
+}
+
+func (s SSHSigner) Sign(message []byte) (string, error) {
+	return SSHSign(s.Keys, message)
+}
+
+func (s SSHSigner) Cosign(proof []byte) (string, error) {
+	return SSHCosign(s.Keys, proof)
+}
+
+func (v SSHVerifier) Verify(proof []byte) ([]byte, []string, error) {
+	threshold := v.Threshold
+	if threshold == 0 {
+		threshold = 1
+	}
+	return SSHVerify(v.Signers, threshold, proof)
+}
+
+func (v SSHVerifier) Rotate(rotation *KeyRotation) (Verifier, error) {
+	if rotation == nil {
+		return v, nil
+	}
+	next, _, _, _, err := ssh.ParseAuthorizedKey([]byte(rotation.Key))
+	if err != nil {
+		return nil, errors.New("Unable to parse next key: " + err.Error())
+	}
+	if SSHFingerprint(next) != rotation.Next {
+		return nil, errors.New("Next key does not match fingerprint")
+	}
+
+	// replace retired key, keeping the principals
+	var retired *SSHAllowedSigner
+	rotated := make([]SSHAllowedSigner, 0, len(v.Signers))
+	for i, signer := range v.Signers {
+		fingerprint := SSHFingerprint(signer.Key)
+		if fingerprint == rotation.Next {
+			return nil, errors.New("Next key is already in use")
+		}
+		if fingerprint == rotation.Retire {
+			retired = &v.Signers[i]
+			continue
+		}
+		rotated = append(rotated, signer)
+	}
+	if retired == nil {
+		return nil, errors.New("Retired key is not in use")
+	}
+	rotated = append(rotated, SSHAllowedSigner{Principals: retired.Principals, Key: next})
+	return SSHVerifier{Signers: rotated, Threshold: v.Threshold}, nil
+}
+
+func (v SSHVerifier) PublicKeys() (string, error) {
+	var allowed string
+	for _, signer := range v.Signers {
+		key := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.Key)))
+		allowed += fmt.Sprintf("%s namespaces=\"%s\" %s\n", strings.Join(signer.Principals, ","), SSHSignatureNamespace, key)
+	}
+	return allowed, nil
+}
@@ -0,0 +1,112 @@
+package fugl
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"strings"
+	"testing"
+)
+
+func newSSHKeys(t *testing.T, n int) ([]ssh.Signer, string) {
+	var signers []ssh.Signer
+	var allowed string
+	for i := 0; i < n; i++ {
+		_, private, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatalf("error creating ssh keys, err=%v", err)
+		}
+		signer, err := ssh.NewSignerFromKey(private)
+		if err != nil {
+			t.Fatalf("error creating ssh signer, err=%v", err)
+		}
+		key := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+		signers = append(signers, signer)
+		allowed += fmt.Sprintf("officer%d@example.com %s\n", i, key)
+	}
+	return signers, allowed
+}
+
+func TestSSH__SignAndVerify(t *testing.T) {
+	signers, allowed := newSSHKeys(t, 3)
+	allowedSigners, err := SSHLoadAllowedSigners([]byte("# comment\n\n" + allowed))
+	if err != nil {
+		t.Fatalf("error reading allowed signers, err=%v", err)
+	}
+	if len(allowedSigners) != 3 {
+		t.Fatalf("expected 3 allowed signers, got %d", len(allowedSigners))
+	}
+
+	message := []byte("this is a test message")
+	sig, err := SSHSign(signers[:2], message)
+	if err != nil {
+		t.Fatalf("error signing message, err=%v", err)
+	}
+	body, fingerprints, err := SSHVerify(allowedSigners, 2, []byte(sig))
+	if err != nil {
+		t.Fatalf("error verifying signatures, err=%v", err)
+	}
+	if string(body) != string(message) {
+		t.Fatal("verified message does not match signed message")
+	}
+	if len(fingerprints) != 2 || fingerprints[0] != SSHFingerprint(signers[0].PublicKey()) {
+		t.Fatalf("unexpected signers: %v", fingerprints)
+	}
+	if _, _, err := SSHVerify(allowedSigners, 3, []byte(sig)); err == nil {
+		t.Fatal("expected an error when threshold is not met")
+	}
+	if _, _, err := SSHVerify(allowedSigners[1:], 1, []byte(sig)); err == nil {
+		t.Fatal("expected an error when signer is not allowed")
+	}
+	if _, _, err := SSHVerify(allowedSigners, 1, []byte("T"+sig[1:])); err == nil {
+		t.Fatal("expected an error verifying tampered message")
+	}
+}
+
+func TestSSH__Cosign(t *testing.T) {
+	signers, allowed := newSSHKeys(t, 2)
+	verifier, err := LoadVerifier(BackendSSH, []byte(allowed), 2)
+	if err != nil {
+		t.Fatalf("error loading verifier, err=%v", err)
+	}
+
+	// officers sign separately: the first signs, the second adds a signature
+	message := []byte("this is a test message")
+	sig, err := SSHSign(signers[:1], message)
+	if err != nil {
+		t.Fatalf("error signing message, err=%v", err)
+	}
+	if _, _, err := verifier.Verify([]byte(sig)); err == nil {
+		t.Fatal("expected an error verifying a single signature")
+	}
+	cosigned, err := CosignProof(SSHSigner{Keys: signers[1:]}, sig)
+	if err != nil {
+		t.Fatalf("error cosigning message, err=%v", err)
+	}
+	body, fingerprints, err := verifier.Verify([]byte(cosigned))
+	if err != nil {
+		t.Fatalf("error verifying cosigned message, err=%v", err)
+	}
+	if string(body) != string(message) || len(fingerprints) != 2 || fingerprints[1] != SSHFingerprint(signers[1].PublicKey()) {
+		t.Fatalf("unexpected signers %v or message %q", fingerprints, body)
+	}
+	if _, err := SSHCosign(signers[:1], []byte(cosigned)); err == nil {
+		t.Fatal("expected an error cosigning with the same key")
+	}
+}
+
+func TestSSH__AllowedSignersNamespace(t *testing.T) {
+	signers, _ := newSSHKeys(t, 1)
+	key := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signers[0].PublicKey())))
+
+	allowed, err := SSHLoadAllowedSigners([]byte(`me@example.com namespaces="git,fugl" ` + key))
+	if err != nil || len(allowed) != 1 {
+		t.Fatalf("error reading allowed signer with namespace, err=%v", err)
+	}
+	if _, err := SSHLoadAllowedSigners([]byte(`me@example.com namespaces="git" ` + key)); err == nil {
+		t.Fatal("expected no allowed signers outside the namespace")
+	}
+	if _, err := SSHLoadAllowedSigners([]byte(`me@example.com cert-authority ` + key)); err == nil {
+		t.Fatal("expected an error for unsupported option")
+	}
+}
@@ -0,0 +1,128 @@
+package fugl
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+/* Persistence of accepted proofs.
+ *
+ * Proofs are ordered by the expiry time of their canary
+ * (which strictly increases along the chain, see CheckCanaryPrevious)
+ * and identified by their hash (see HashString).
+ */
+
+var (
+	ErrProofNotFound = errors.New("Proof not found in store")
+	ErrStoreConflict = errors.New("Store was modified concurrently")
+)
+
+type Store interface {
+	Save(proof string, canary *Canary) error             // stores an accepted proof
+	Latest() (string, error)                             // newest proof (empty if the store is empty)
+	List(from time.Time, to time.Time) ([]string, error) // proofs expiring in [from, to) oldest first, a zero time is unbounded
+	Get(hash string) (string, error)                     // proof with the given hash (ErrProofNotFound if absent)
+	Count() (int, error)                                 // number of stored proofs
+}
+
+/* Stores may keep RFC 3161 timestamp tokens alongside the proofs
+ */
+
+type TimestampStore interface {
+	SaveTimestamp(hash string, token []byte) error // stores the token over the proof with the given hash
+	Timestamp(hash string) ([]byte, error)         // token over the proof with the given hash (nil if absent)
+}
+
+// checks whether the time is within [from, to)
+func inRange(when time.Time, from time.Time, to time.Time) bool {
+	if !from.IsZero() && when.Before(from) {
+		return false
+	}
+	return to.IsZero() || when.Before(to)
+}
+
+/* Opens the store described by spec, of the form "<kind>:<location>":
+ *
+ *   dir:./proofs      directory store (the default when no kind is given)
+ *   bolt:./proofs.db  embedded database store
+ *   git:./canary      git repository, committing every proof
+ *
+ * Only the kinds above are recognized, any other spec is the path of a directory store
+ * (which may contain a colon, e.g. "/srv/canary:prod").
+ */
+
+const (
+	StoreDirectory = "dir"
+	StoreBolt      = "bolt"
+	StoreGit       = "git"
+)
+
+// returns the kind and location of the store described by spec (see OpenStore)
+func ParseStoreSpec(spec string) (string, string) {
+	for _, kind := range []string{StoreDirectory, StoreBolt, StoreGit} {
+		if strings.HasPrefix(spec, kind+":") {
+			return kind, strings.TrimPrefix(spec, kind+":")
+		}
+	}
+	return StoreDirectory, spec
+}
+
+func OpenStore(spec string) (Store, error) {
+	kind, location := ParseStoreSpec(spec)
+	if location == "" {
+		return nil, errors.New("No store location specified")
+	}
+	switch kind {
+	case StoreDirectory:
+		return NewDirectoryStore(location)
+	case StoreBolt:
+		return NewBoltStore(location)
+	case StoreGit:
+		return NewGitStore(location)
+	}
+	return nil, errors.New("Unsupported store: " + kind)
+}
+
+/* Copies every proof (and timestamp) from src to dst, oldest first.
+ * The proofs are verified (following key rotations),
+ * as the canaries are required to index them.
+ *
+ * Returns the number of proofs copied.
+ */
+
+func MigrateStore(dst Store, src Store, verifier Verifier) (int, error) {
+	proofs, err := src.List(time.Time{}, time.Time{})
+	if err != nil {
+		return 0, err
+	}
+	srcTimestamps, _ := src.(TimestampStore)
+	dstTimestamps, _ := dst.(TimestampStore)
+	for i, proof := range proofs {
+		opened, err := VerifyProof(verifier, proof)
+		if err != nil {
+			return i, err
+		}
+		err = dst.Save(proof, opened.Canary)
+		if err != nil {
+			return i, err
+		}
+		if srcTimestamps != nil && dstTimestamps != nil {
+			token, err := srcTimestamps.Timestamp(HashString(proof))
+			if err != nil {
+				return i, err
+			}
+			if token != nil {
+				err = dstTimestamps.SaveTimestamp(HashString(proof), token)
+				if err != nil {
+					return i, err
+				}
+			}
+		}
+		verifier, err = verifier.Rotate(opened.Canary.Rotation)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(proofs), nil
+}
@@ -0,0 +1,228 @@
+package fugl
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"go.etcd.io/bbolt"
+	"time"
+)
+
+/* Store backed by an embedded key-value database (bbolt),
+ * for servers holding many proofs.
+ *
+ * Proofs are stored by hash, with indexes on expiry and creation time
+ * (keyed by the big-endian unix time followed by the hash, hence ordered by time).
+ */
+
+var (
+	boltBucketProofs     = []byte("proofs")     // hash -> proof
+	boltBucketExpiry     = []byte("expiry")     // expiry | hash -> hash
+	boltBucketCreation   = []byte("creation")   // creation | hash -> hash
+	boltBucketTimestamps = []byte("timestamps") // hash -> timestamp token
+	boltBucketQuarantine = []byte("quarantine") // hash -> quarantined proof
+)
+
+type BoltStore struct {
+	db *bbolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{boltBucketProofs, boltBucketExpiry, boltBucketCreation, boltBucketTimestamps, boltBucketQuarantine} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func boltTimeKey(when time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(when.Unix()))
+	return key
+}
+
+func boltIndexKey(when time.Time, hash string) ([]byte, error) {
+	raw, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, errors.New("Invalid proof hash")
+	}
+	return append(boltTimeKey(when), raw...), nil
+}
+
+func (s *BoltStore) Save(proof string, canary *Canary) error {
+	hash := HashString(proof)
+	expiry, err := boltIndexKey(canary.Expiry.Time(), hash)
+	if err != nil {
+		return err
+	}
+	creation, err := boltIndexKey(canary.Creation.Time(), hash)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		err := tx.Bucket(boltBucketProofs).Put([]byte(hash), []byte(proof))
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(boltBucketExpiry).Put(expiry, []byte(hash))
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(boltBucketCreation).Put(creation, []byte(hash))
+	})
+}
+
+func (s *BoltStore) Latest() (string, error) {
+	var proof string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		_, hash := tx.Bucket(boltBucketExpiry).Cursor().Last()
+		if hash != nil {
+			proof = string(tx.Bucket(boltBucketProofs).Get(hash))
+		}
+		return nil
+	})
+	return proof, err
+}
+
+// lists proofs from an index in [from, to)
+func (s *BoltStore) listIndex(index []byte, from time.Time, to time.Time) ([]string, error) {
+	var proofs []string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket(index).Cursor()
+		key, hash := cursor.First()
+		if !from.IsZero() {
+			key, hash = cursor.Seek(boltTimeKey(from))
+		}
+		for ; key != nil; key, hash = cursor.Next() {
+			when := time.Unix(int64(binary.BigEndian.Uint64(key[:8])), 0)
+			if !inRange(when, from, to) {
+				break
+			}
+			proof := tx.Bucket(boltBucketProofs).Get(hash)
+			if proof == nil {
+				return errors.New("Index refers to missing proof: " + string(hash))
+			}
+			proofs = append(proofs, string(proof))
+		}
+		return nil
+	})
+	return proofs, err
+}
+
+func (s *BoltStore) List(from time.Time, to time.Time) ([]string, error) {
+	return s.listIndex(boltBucketExpiry, from, to)
+}
+
+/* Lists proofs of canaries created in [from, to), oldest first
+ */
+
+func (s *BoltStore) ListCreated(from time.Time, to time.Time) ([]string, error) {
+	return s.listIndex(boltBucketCreation, from, to)
+}
+
+func (s *BoltStore) Get(hash string) (string, error) {
+	var proof []byte
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		proof = tx.Bucket(boltBucketProofs).Get([]byte(hash))
+		if proof == nil {
+			return ErrProofNotFound
+		}
+		proof = append([]byte{}, proof...)
+		return nil
+	})
+	return string(proof), err
+}
+
+func (s *BoltStore) Count() (int, error) {
+	var count int
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		count = tx.Bucket(boltBucketProofs).Stats().KeyN
+		return nil
+	})
+	return count, err
+}
+
+func (s *BoltStore) SaveTimestamp(hash string, token []byte) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket(boltBucketProofs).Get([]byte(hash)) == nil {
+			return ErrProofNotFound
+		}
+		return tx.Bucket(boltBucketTimestamps).Put([]byte(hash), token)
+	})
+}
+
+func (s *BoltStore) Timestamp(hash string) ([]byte, error) {
+	var token []byte
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket(boltBucketProofs).Get([]byte(hash)) == nil {
+			return ErrProofNotFound
+		}
+		if value := tx.Bucket(boltBucketTimestamps).Get([]byte(hash)); value != nil {
+			token = append([]byte{}, value...)
+		}
+		return nil
+	})
+	return token, err
+}
+
+/* Moves the proof to the quarantine bucket and removes it from the indexes
+ */
+
+func (s *BoltStore) Quarantine(hash string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		proof := tx.Bucket(boltBucketProofs).Get([]byte(hash))
+		if proof == nil {
+			return ErrProofNotFound
+		}
+		err := tx.Bucket(boltBucketQuarantine).Put([]byte(hash), proof)
+		if err != nil {
+			return err
+		}
+		return boltDelete(tx, hash)
+	})
+}
+
+func (s *BoltStore) Delete(hash string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket(boltBucketProofs).Get([]byte(hash)) == nil {
+			return ErrProofNotFound
+		}
+		err := tx.Bucket(boltBucketTimestamps).Delete([]byte(hash))
+		if err != nil {
+			return err
+		}
+		return boltDelete(tx, hash)
+	})
+}
+
+// removes the proof and its index entries
+func boltDelete(tx *bbolt.Tx, hash string) error {
+	for _, index := range [][]byte{boltBucketExpiry, boltBucketCreation} {
+		cursor := tx.Bucket(index).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			if string(value) == hash {
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+				break // a proof has a single entry per index
+			}
+		}
+	}
+	return tx.Bucket(boltBucketProofs).Delete([]byte(hash))
+}
@@ -0,0 +1,303 @@
+package fugl
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+/* The default store: a flat directory with a file per proof,
+ * named by the expiry time and hash of the proof (see ProofFileName),
+ * hence the lexical order of the files is the order of the proofs.
+ *
+ * Timestamp tokens are stored next to the proof, with an additional extension.
+ * Quarantined proofs are renamed with an additional extension.
+ *
+ * Files are written atomically (see writeFileAtomic),
+ * when opening the store, temporary files left by an interrupted write are removed
+ * and proofs which do not match the hash in their name (e.g. truncated by a crash) are quarantined.
+ */
+
+const (
+	QuarantineFileExtension = ".quarantine"
+	TempFileExtension       = ".tmp"
+)
+
+/* Writes the file such that it is either fully written or not at all,
+ * even if the system crashes: the data is written to a temporary file in the same directory,
+ * synced to disk and renamed to the final name, after which the directory is synced.
+ */
+
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	dir, base := path.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	file, err := ioutil.TempFile(dir, "."+base+".*"+TempFileExtension)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // no-op after rename
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), name); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// persists the entries (e.g. a rename) of the directory
+func syncDir(dir string) error {
+	handle, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	return handle.Sync()
+}
+
+type DirectoryStore struct {
+	Dir string
+}
+
+func NewDirectoryStore(dir string) (*DirectoryStore, error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		err = os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			return nil, err
+		}
+	}
+	store := &DirectoryStore{Dir: dir}
+	if err := store.recover(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// cleans up after interrupted writes
+func (s *DirectoryStore) recover() error {
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), TempFileExtension) {
+			if err := os.Remove(path.Join(s.Dir, file.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	proofFiles, err := s.listProofFiles()
+	if err != nil {
+		return err
+	}
+	for _, proofFile := range proofFiles {
+		_, hash, err := parseProofFileName(proofFile)
+		if err != nil {
+			return err
+		}
+		proof, err := s.readProof(proofFile)
+		if err != nil {
+			return err
+		}
+		if HashString(proof) != hash {
+			err = os.Rename(path.Join(s.Dir, proofFile), path.Join(s.Dir, proofFile+QuarantineFileExtension))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return syncDir(s.Dir)
+}
+
+func (s *DirectoryStore) listProofFiles() ([]string, error) {
+	var proofFiles []string
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		// check if proof file
+		if file.IsDir() {
+			return nil, errors.New("Directory found in store")
+		}
+		if strings.HasSuffix(file.Name(), TimestampFileExtension) ||
+			strings.HasSuffix(file.Name(), QuarantineFileExtension) ||
+			strings.HasSuffix(file.Name(), TempFileExtension) {
+			continue
+		}
+		if !strings.HasSuffix(file.Name(), ProofFileExtension) {
+			return nil, errors.New("Non-proof file in store: " + file.Name())
+		}
+		proofFiles = append(proofFiles, file.Name())
+	}
+	sort.Strings(proofFiles)
+	return proofFiles, nil
+}
+
+// parses the expiry time and hash from the name of a proof file
+func parseProofFileName(name string) (time.Time, string, error) {
+	parts := strings.Split(strings.TrimSuffix(name, ProofFileExtension), "-")
+	if len(parts) != 3 || parts[0] != "proof" {
+		return time.Time{}, "", errors.New("Invalid proof file name: " + name)
+	}
+	when, err := time.Parse(ProofFileTimeFormat, parts[1])
+	if err != nil {
+		return time.Time{}, "", errors.New("Invalid proof file name: " + name)
+	}
+	return when, parts[2], nil
+}
+
+func (s *DirectoryStore) readProof(name string) (string, error) {
+	proof, err := ioutil.ReadFile(path.Join(s.Dir, name))
+	return string(proof), err
+}
+
+func (s *DirectoryStore) Save(proof string, canary *Canary) error {
+	date := canary.Expiry.Time().UTC().Format(ProofFileTimeFormat)
+	fileName := fmt.Sprintf(ProofFileName, date, HashString(proof))
+	return writeFileAtomic(path.Join(s.Dir, fileName), []byte(proof), 0600)
+}
+
+func (s *DirectoryStore) Latest() (string, error) {
+	proofFiles, err := s.listProofFiles()
+	if err != nil || len(proofFiles) == 0 {
+		return "", err
+	}
+	return s.readProof(proofFiles[len(proofFiles)-1])
+}
+
+func (s *DirectoryStore) List(from time.Time, to time.Time) ([]string, error) {
+	proofFiles, err := s.listProofFiles()
+	if err != nil {
+		return nil, err
+	}
+	proofs := make([]string, 0, len(proofFiles))
+	for _, proofFile := range proofFiles {
+		when, _, err := parseProofFileName(proofFile)
+		if err != nil {
+			return nil, err
+		}
+		if !inRange(when, from, to) {
+			continue
+		}
+		proof, err := s.readProof(proofFile)
+		if err != nil {
+			return nil, err
+		}
+		proofs = append(proofs, proof)
+	}
+	return proofs, nil
+}
+
+func (s *DirectoryStore) findProofFile(hash string) (string, error) {
+	proofFiles, err := s.listProofFiles()
+	if err != nil {
+		return "", err
+	}
+	for _, proofFile := range proofFiles {
+		if strings.HasSuffix(proofFile, "-"+hash+ProofFileExtension) {
+			return proofFile, nil
+		}
+	}
+	return "", ErrProofNotFound
+}
+
+func (s *DirectoryStore) Get(hash string) (string, error) {
+	proofFile, err := s.findProofFile(hash)
+	if err != nil {
+		return "", err
+	}
+	return s.readProof(proofFile)
+}
+
+func (s *DirectoryStore) Count() (int, error) {
+	proofFiles, err := s.listProofFiles()
+	return len(proofFiles), err
+}
+
+func (s *DirectoryStore) SaveTimestamp(hash string, token []byte) error {
+	proofFile, err := s.findProofFile(hash)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path.Join(s.Dir, proofFile+TimestampFileExtension), token, 0600)
+}
+
+func (s *DirectoryStore) Timestamp(hash string) ([]byte, error) {
+	proofFile, err := s.findProofFile(hash)
+	if err != nil {
+		return nil, err
+	}
+	token, err := ioutil.ReadFile(path.Join(s.Dir, proofFile+TimestampFileExtension))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return token, err
+}
+
+func (s *DirectoryStore) Quarantine(hash string) error {
+	proofFile, err := s.findProofFile(hash)
+	if err == ErrProofNotFound {
+		proofFile, err = s.findProofContent(hash)
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Rename(path.Join(s.Dir, proofFile), path.Join(s.Dir, proofFile+QuarantineFileExtension))
+	if err != nil {
+		return err
+	}
+	return syncDir(s.Dir)
+}
+
+// finds the file by the hash of its content (the name may not match a corrupted proof)
+func (s *DirectoryStore) findProofContent(hash string) (string, error) {
+	proofFiles, err := s.listProofFiles()
+	if err != nil {
+		return "", err
+	}
+	for _, proofFile := range proofFiles {
+		proof, err := s.readProof(proofFile)
+		if err != nil {
+			return "", err
+		}
+		if HashString(proof) == hash {
+			return proofFile, nil
+		}
+	}
+	return "", ErrProofNotFound
+}
+
+func (s *DirectoryStore) Delete(hash string) error {
+	proofFile, err := s.findProofFile(hash)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path.Join(s.Dir, proofFile+TimestampFileExtension))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = os.Remove(path.Join(s.Dir, proofFile))
+	if err != nil {
+		return err
+	}
+	return syncDir(s.Dir)
+}
@@ -0,0 +1,178 @@
+package fugl
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+/* Store backed by a local git repository,
+ * committing every accepted proof, giving a tamper-evident history which is easily mirrored
+ * (e.g. by pushing the repository elsewhere).
+ *
+ * Files (in the work tree):
+ *
+ *   proofs/proof-<expiry>-<hash>.proof  the proofs (a directory store, see DirectoryStore)
+ *   latest.proof                        copy of the newest proof
+ *
+ * Changes are only kept once committed:
+ * a failed commit restores the files from the last commit,
+ * as does opening the store (e.g. after a crash between writing and committing).
+ *
+ * Requires the git executable.
+ */
+
+const (
+	GitLatestFile  = "latest.proof"
+	GitProofsDir   = "proofs"
+	gitDirectory   = ".git"
+	gitAuthorName  = "fugl" // identity of commits made by the store
+	gitAuthorEmail = "fugl@localhost"
+)
+
+type GitStore struct {
+	Dir    string // work tree of the repository
+	proofs *DirectoryStore
+}
+
+/* Opens the repository at dir, initializing it if needed
+ */
+
+func NewGitStore(dir string) (*GitStore, error) {
+	proofs, err := NewDirectoryStore(path.Join(dir, GitProofsDir))
+	if err != nil {
+		return nil, err
+	}
+	store := &GitStore{Dir: dir, proofs: proofs}
+	if _, err := os.Stat(path.Join(dir, gitDirectory)); os.IsNotExist(err) {
+		if err := store.git("init", "--quiet"); err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	if err := store.restore(GitProofsDir, GitLatestFile); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *GitStore) git(args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", s.Dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME="+gitAuthorName,
+		"GIT_AUTHOR_EMAIL="+gitAuthorEmail,
+		"GIT_COMMITTER_NAME="+gitAuthorName,
+		"GIT_COMMITTER_EMAIL="+gitAuthorEmail,
+	)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.New("git " + args[0] + " failed: " + err.Error() + ": " + strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// stages the files (relative to the work tree) and commits them, restoring the files on failure
+func (s *GitStore) commit(message string, files ...string) error {
+	err := s.git(append([]string{"add", "--"}, files...)...)
+	if err == nil {
+		err = s.git("commit", "--quiet", "--no-verify", "--no-gpg-sign", "-m", message)
+	}
+	if err != nil {
+		if restoreErr := s.restore(files...); restoreErr != nil {
+			return errors.New(err.Error() + " (" + restoreErr.Error() + ")")
+		}
+	}
+	return err
+}
+
+// discards changes to the files (relative to the work tree) since the last commit
+func (s *GitStore) restore(files ...string) error {
+	err := s.git(append([]string{"reset", "--quiet", "--"}, files...)...)
+	if err != nil {
+		return err
+	}
+	if s.git("rev-parse", "--verify", "--quiet", "HEAD") == nil {
+		err = s.git(append([]string{"checkout", "--"}, files...)...)
+		if err != nil {
+			return err
+		}
+	}
+	return s.git(append([]string{"clean", "-f", "-d", "--quiet", "--"}, files...)...)
+}
+
+func (s *GitStore) Save(proof string, canary *Canary) error {
+	err := s.proofs.Save(proof, canary)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(path.Join(s.Dir, GitLatestFile), []byte(proof), 0600)
+	if err != nil {
+		return err
+	}
+	message := "Add canary " + HashString(proof) + "\n\n" +
+		"Author: " + canary.Author + "\n" +
+		"Expiry: " + canary.Expiry.String() + "\n"
+	return s.commit(message, GitProofsDir, GitLatestFile)
+}
+
+func (s *GitStore) Latest() (string, error) {
+	proof, err := ioutil.ReadFile(path.Join(s.Dir, GitLatestFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return string(proof), err
+}
+
+func (s *GitStore) List(from time.Time, to time.Time) ([]string, error) {
+	return s.proofs.List(from, to)
+}
+
+func (s *GitStore) Get(hash string) (string, error) {
+	return s.proofs.Get(hash)
+}
+
+func (s *GitStore) Count() (int, error) {
+	return s.proofs.Count()
+}
+
+func (s *GitStore) SaveTimestamp(hash string, token []byte) error {
+	err := s.proofs.SaveTimestamp(hash, token)
+	if err != nil {
+		return err
+	}
+	return s.commit("Add timestamp "+hash, GitProofsDir)
+}
+
+func (s *GitStore) Timestamp(hash string) ([]byte, error) {
+	return s.proofs.Timestamp(hash)
+}
+
+func (s *GitStore) Quarantine(hash string) error {
+	err := s.proofs.Quarantine(hash)
+	if err != nil {
+		return err
+	}
+	latest, err := s.proofs.Latest()
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(path.Join(s.Dir, GitLatestFile), []byte(latest), 0600)
+	if err != nil {
+		return err
+	}
+	return s.commit("Quarantine proof "+hash, GitProofsDir, GitLatestFile)
+}
+
+func (s *GitStore) Delete(hash string) error {
+	err := s.proofs.Delete(hash)
+	if err != nil {
+		return err
+	}
+	return s.commit("Archive proof "+hash, GitProofsDir)
+}
@@ -0,0 +1,484 @@
+package fugl
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+/* Store backed by an S3-compatible object storage bucket (path-style addressing),
+ * allowing the server to run without local state.
+ *
+ * Objects (below the prefix):
+ *
+ *   proofs/<hash>.proof             the proof
+ *   expiry/<expiry>-<hash>-<prev>   empty object, ordering the proofs by expiry (prev is the hash of the preceding proof)
+ *   timestamps/<hash>.tsr           timestamp token over the proof
+ *   latest                          hash of the newest proof
+ *
+ * The latest object is updated using conditional writes,
+ * a new proof is only accepted if it links to the current latest proof (see Canary.Previous),
+ * otherwise another replica has accepted a proof concurrently and ErrStoreConflict is returned.
+ *
+ * The proof and index objects are written before the latest object and never removed by a failed save
+ * (the objects are named by content, another replica may be saving the same proof),
+ * instead the stored proofs are those on the chain ending at the latest proof:
+ * List and Count follow the links of the index back from the latest proof, skipping proofs left by failed saves.
+ */
+
+type S3Config struct {
+	Endpoint  string // e.g. "https://s3.eu-west-1.amazonaws.com" or "http://127.0.0.1:9000"
+	Region    string // e.g. "eu-west-1"
+	Bucket    string // name of the bucket
+	Prefix    string // prefix of all objects (e.g. "fugl/")
+	AccessKey string
+	SecretKey string
+}
+
+type S3Store struct {
+	config S3Config
+	client *http.Client
+}
+
+const (
+	s3ObjectLatest     = "latest"
+	s3PrefixProofs     = "proofs/"
+	s3PrefixExpiry     = "expiry/"
+	s3PrefixTimestamps = "timestamps/"
+	s3MaxObjectSize    = 1 << 24
+)
+
+func NewS3Store(config S3Config, client *http.Client) (*S3Store, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, errors.New("S3 store requires endpoint and bucket")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3Store{config: config, client: client}, nil
+}
+
+/* AWS signature version 4
+ */
+
+func awsURIEncode(s string, encodeSlash bool) string {
+	var out strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			out.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			out.WriteByte(b)
+		default:
+			fmt.Fprintf(&out, "%%%02X", b)
+		}
+	}
+	return out.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// signs the request (including every header set), payload is the request body
+func signS3Request(req *http.Request, payload []byte, config S3Config, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", sha256Hex(payload))
+
+	// canonical headers
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// canonical query
+	query := req.URL.Query()
+	var params []string
+	for key, values := range query {
+		for _, value := range values {
+			params = append(params, awsURIEncode(key, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+
+	canonical := strings.Join([]string{
+		req.Method,
+		awsURIEncode(req.URL.Path, false),
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(payload),
+	}, "\n")
+	scope := date + "/" + config.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+config.SecretKey), date)
+	key = hmacSHA256(key, config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		config.AccessKey, scope, signedHeaders, signature))
+}
+
+/* Object operations
+ */
+
+// object is the full name of the object (empty for the bucket itself)
+func (s *S3Store) do(method string, object string, query url.Values, body []byte, headers map[string]string) (*http.Response, []byte, error) {
+	path := "/" + s.config.Bucket
+	if object != "" {
+		path += "/" + object
+	}
+	target, err := url.Parse(strings.TrimRight(s.config.Endpoint, "/") + path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if query != nil {
+		target.RawQuery = query.Encode()
+	}
+	req, err := http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	signS3Request(req, body, s.config, time.Now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, s3MaxObjectSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, data, nil
+}
+
+func s3StatusError(op string, key string, resp *http.Response) error {
+	return errors.New(fmt.Sprintf("S3 %s %s failed with status: %s", op, key, resp.Status))
+}
+
+// returns the object and its etag, nil if it does not exist
+func (s *S3Store) getObject(key string) ([]byte, string, error) {
+	resp, data, err := s.do(http.MethodGet, s.config.Prefix+key, nil, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", s3StatusError("GET", key, resp)
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// conditional headers are If-Match / If-None-Match, a failed condition is ErrStoreConflict
+func (s *S3Store) putObject(key string, data []byte, headers map[string]string) error {
+	resp, _, err := s.do(http.MethodPut, s.config.Prefix+key, nil, data, headers)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed || resp.StatusCode == http.StatusConflict {
+		return ErrStoreConflict
+	}
+	if resp.StatusCode != http.StatusOK {
+		return s3StatusError("PUT", key, resp)
+	}
+	return nil
+}
+
+func (s *S3Store) deleteObject(key string) error {
+	resp, _, err := s.do(http.MethodDelete, s.config.Prefix+key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3StatusError("DELETE", key, resp)
+	}
+	return nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// lists the keys (relative to the store prefix) starting with prefix, in lexical order
+func (s *S3Store) listKeys(prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", s.config.Prefix+prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, data, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, s3StatusError("LIST", prefix, resp)
+		}
+		var result s3ListResult
+		if err := xml.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			keys = append(keys, strings.TrimPrefix(object.Key, s.config.Prefix))
+		}
+		if !result.IsTruncated {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+/* Index of the proofs on the chain
+ */
+
+type s3IndexEntry struct {
+	key      string
+	expiry   time.Time
+	hash     string
+	previous string // empty if unknown (index written by an older version)
+	linked   bool   // previous is known
+}
+
+func parseS3IndexKey(key string) (s3IndexEntry, error) {
+	entry := s3IndexEntry{key: key}
+	parts := strings.Split(strings.TrimPrefix(key, s3PrefixExpiry), "-")
+	if len(parts) != 2 && len(parts) != 3 {
+		return entry, errors.New("Invalid object in store: " + key)
+	}
+	when, err := time.Parse(ProofFileTimeFormat, parts[0])
+	if err != nil {
+		return entry, errors.New("Invalid object in store: " + key)
+	}
+	entry.expiry, entry.hash = when, parts[1]
+	if len(parts) == 3 {
+		entry.previous, entry.linked = parts[2], true
+	}
+	return entry, nil
+}
+
+func (s *S3Store) latestHash() (string, []byte, string, error) {
+	latest, etag, err := s.getObject(s3ObjectLatest)
+	return string(latest), latest, etag, err
+}
+
+/* Returns the index entries of the chain ending at the latest proof (oldest first).
+ *
+ * The links are followed back from the latest proof,
+ * a link to a proof which is not indexed (removed, see Delete) or an entry without a link
+ * continues at the newest indexed proof expiring before it.
+ */
+
+func (s *S3Store) chain() ([]s3IndexEntry, error) {
+	keys, err := s.listKeys(s3PrefixExpiry)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]s3IndexEntry, 0, len(keys))
+	position := make(map[string]int) // hash -> position in entries
+	for _, key := range keys {
+		entry, err := parseS3IndexKey(key)
+		if err != nil {
+			return nil, err
+		}
+		position[entry.hash] = len(entries)
+		entries = append(entries, entry)
+	}
+	latest, _, _, err := s.latestHash()
+	if err != nil || latest == "" {
+		return nil, err
+	}
+	i, ok := position[latest]
+	if !ok {
+		return nil, errors.New("Latest proof is not indexed: " + latest)
+	}
+	var chain []s3IndexEntry
+	for {
+		entry := entries[i]
+		chain = append([]s3IndexEntry{entry}, chain...)
+		if entry.linked && entry.previous == "" {
+			break
+		}
+		if j, ok := position[entry.previous]; ok && entry.linked && j < i {
+			i = j
+			continue
+		}
+		if i == 0 {
+			break
+		}
+		i--
+	}
+	return chain, nil
+}
+
+/* Store implementation
+ */
+
+func (s *S3Store) Save(proof string, canary *Canary) error {
+	hash := HashString(proof)
+	proofKey := s3PrefixProofs + hash + ProofFileExtension
+	expiryKey := s3PrefixExpiry + canary.Expiry.Time().UTC().Format(ProofFileTimeFormat) + "-" + hash + "-" + canary.Previous
+
+	// the new proof must supersede the latest proof
+	latest, exists, etag, err := s.latestHash()
+	if err != nil {
+		return err
+	}
+	if latest == hash {
+		return nil // saved by another replica
+	}
+	if latest != canary.Previous {
+		return ErrStoreConflict
+	}
+
+	// write proof and index, then advance latest (only if unchanged)
+	err = s.putObject(proofKey, []byte(proof), nil)
+	if err != nil {
+		return err
+	}
+	err = s.putObject(expiryKey, nil, nil)
+	if err != nil {
+		return err
+	}
+	condition := map[string]string{"If-None-Match": "*"}
+	if exists != nil {
+		condition = map[string]string{"If-Match": etag}
+	}
+	err = s.putObject(s3ObjectLatest, []byte(hash), condition)
+	if err != nil {
+		// the write may have succeeded (e.g. timeout) or another replica saved the same proof
+		if latest, _, _, recheck := s.latestHash(); recheck == nil && latest == hash {
+			return nil
+		}
+	}
+	return err
+}
+
+func (s *S3Store) Latest() (string, error) {
+	hash, _, _, err := s.latestHash()
+	if err != nil || hash == "" {
+		return "", err
+	}
+	return s.Get(hash)
+}
+
+func (s *S3Store) List(from time.Time, to time.Time) ([]string, error) {
+	chain, err := s.chain()
+	if err != nil {
+		return nil, err
+	}
+	var proofs []string
+	for _, entry := range chain {
+		if !inRange(entry.expiry, from, to) {
+			continue
+		}
+		proof, err := s.Get(entry.hash)
+		if err != nil {
+			return nil, err
+		}
+		proofs = append(proofs, proof)
+	}
+	return proofs, nil
+}
+
+func (s *S3Store) Get(hash string) (string, error) {
+	proof, _, err := s.getObject(s3PrefixProofs + hash + ProofFileExtension)
+	if err != nil {
+		return "", err
+	}
+	if proof == nil {
+		return "", ErrProofNotFound
+	}
+	return string(proof), nil
+}
+
+func (s *S3Store) Count() (int, error) {
+	chain, err := s.chain()
+	return len(chain), err
+}
+
+func (s *S3Store) SaveTimestamp(hash string, token []byte) error {
+	if _, err := s.Get(hash); err != nil {
+		return err
+	}
+	return s.putObject(s3PrefixTimestamps+hash+TimestampFileExtension, token, nil)
+}
+
+func (s *S3Store) Timestamp(hash string) ([]byte, error) {
+	if _, err := s.Get(hash); err != nil {
+		return nil, err
+	}
+	token, _, err := s.getObject(s3PrefixTimestamps + hash + TimestampFileExtension)
+	return token, err
+}
+
+func (s *S3Store) Delete(hash string) error {
+	if _, err := s.Get(hash); err != nil {
+		return err
+	}
+	keys, err := s.listKeys(s3PrefixExpiry)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if entry, err := parseS3IndexKey(key); err == nil && entry.hash == hash {
+			if err := s.deleteObject(key); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.deleteObject(s3PrefixTimestamps + hash + TimestampFileExtension); err != nil {
+		return err
+	}
+	return s.deleteObject(s3PrefixProofs + hash + ProofFileExtension)
+}
@@ -0,0 +1,344 @@
+package fugl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* exercises a store implementation,
+ * the store must initially be empty.
+ * The proofs saved are linked (as some stores require)
+ */
+
+func testStore(t *testing.T, store Store) {
+	if count, err := store.Count(); err != nil || count != 0 {
+		t.Fatalf("expected empty store, got %d proofs (err=%v)", count, err)
+	}
+	if latest, err := store.Latest(); err != nil || latest != "" {
+		t.Fatalf("expected no latest proof in empty store, err=%v", err)
+	}
+
+	// proofs expiring a day apart
+	start := time.Date(2017, 2, 11, 11, 27, 54, 0, time.UTC)
+	var proofs []string
+	for i := 0; i < 3; i++ {
+		canary := Canary{
+			Version:  CanaryVersion,
+			Creation: CanaryTime(start.Add(time.Duration(i) * 24 * time.Hour)),
+			Expiry:   CanaryTime(start.Add(time.Duration(i+1) * 24 * time.Hour)),
+			Nonce:    GetRandStr(CanaryNonceSize),
+		}
+		if i > 0 {
+			canary.Previous = HashString(proofs[i-1])
+		}
+		proof := "proof of " + canary.Nonce
+		if err := store.Save(proof, &canary); err != nil {
+			t.Fatalf("error saving proof, err=%v", err)
+		}
+		proofs = append(proofs, proof)
+	}
+
+	if count, err := store.Count(); err != nil || count != 3 {
+		t.Fatalf("expected 3 proofs, got %d (err=%v)", count, err)
+	}
+	if latest, err := store.Latest(); err != nil || latest != proofs[2] {
+		t.Fatalf("unexpected latest proof %q, err=%v", latest, err)
+	}
+	all, err := store.List(time.Time{}, time.Time{})
+	if err != nil || len(all) != 3 {
+		t.Fatalf("expected 3 proofs listed, got %d (err=%v)", len(all), err)
+	}
+	for i := range proofs {
+		if all[i] != proofs[i] {
+			t.Fatalf("proofs not listed in order: %v", all)
+		}
+	}
+	middle, err := store.List(start.Add(36*time.Hour), start.Add(72*time.Hour))
+	if err != nil || len(middle) != 1 || middle[0] != proofs[1] {
+		t.Fatalf("unexpected proofs in range: %v (err=%v)", middle, err)
+	}
+	for _, proof := range proofs {
+		found, err := store.Get(HashString(proof))
+		if err != nil || found != proof {
+			t.Fatalf("unexpected proof %q by hash, err=%v", found, err)
+		}
+	}
+	if _, err := store.Get(HashString("missing")); err != ErrProofNotFound {
+		t.Fatalf("expected ErrProofNotFound, got %v", err)
+	}
+
+	// timestamp tokens (optional)
+	if timestamps, ok := store.(TimestampStore); ok {
+		hash := HashString(proofs[1])
+		if token, err := timestamps.Timestamp(hash); err != nil || token != nil {
+			t.Fatalf("expected no timestamp, err=%v", err)
+		}
+		if err := timestamps.SaveTimestamp(hash, []byte("token")); err != nil {
+			t.Fatalf("error saving timestamp, err=%v", err)
+		}
+		if token, err := timestamps.Timestamp(hash); err != nil || string(token) != "token" {
+			t.Fatalf("unexpected timestamp %q, err=%v", token, err)
+		}
+		if count, err := store.Count(); err != nil || count != 3 {
+			t.Fatalf("timestamp counted as proof, got %d proofs (err=%v)", count, err)
+		}
+	}
+}
+
+func TestStore__Directory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fugl-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewDirectoryStore(dir + "/proofs")
+	if err != nil {
+		t.Fatalf("error creating directory store, err=%v", err)
+	}
+	testStore(t, store)
+}
+
+func TestStore__Recover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fugl-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, _ := NewDirectoryStore(dir)
+	canary := Canary{Expiry: CanaryTime(time.Now())}
+	if err := store.Save("complete proof", &canary); err != nil {
+		t.Fatalf("error saving proof, err=%v", err)
+	}
+
+	// leftovers of interrupted writes: a temporary file and a truncated proof
+	latest := fmt.Sprintf(ProofFileName, "29991231000000", HashString("complete proof of a later canary"))
+	ioutil.WriteFile(dir+"/"+latest, []byte("complete proof of a"), 0600)
+	ioutil.WriteFile(dir+"/.proof-x.proof.123"+TempFileExtension, []byte("partial"), 0600)
+
+	store, err = NewDirectoryStore(dir)
+	if err != nil {
+		t.Fatalf("error reopening store, err=%v", err)
+	}
+	if proof, _ := store.Latest(); proof != "complete proof" {
+		t.Fatalf("truncated proof not recovered, latest is %q", proof)
+	}
+	if _, err := os.Stat(dir + "/" + latest + QuarantineFileExtension); err != nil {
+		t.Fatalf("truncated proof not quarantined, err=%v", err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Fatalf("expected temporary file removed, found %d files", len(files))
+	}
+}
+
+func TestStore__Bolt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fugl-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewBoltStore(dir + "/proofs.db")
+	if err != nil {
+		t.Fatalf("error creating bolt store, err=%v", err)
+	}
+	defer store.Close()
+	testStore(t, store)
+
+	created, err := store.ListCreated(time.Time{}, time.Date(2017, 2, 12, 12, 0, 0, 0, time.UTC))
+	if err != nil || len(created) != 2 {
+		t.Fatalf("expected 2 proofs created in range, got %d (err=%v)", len(created), err)
+	}
+
+	latest, _ := store.Latest()
+	if err := store.Quarantine(HashString(latest)); err != nil {
+		t.Fatalf("error quarantining proof, err=%v", err)
+	}
+	if count, _ := store.Count(); count != 2 {
+		t.Fatalf("expected 2 proofs after quarantine, got %d", count)
+	}
+	if all, _ := store.List(time.Time{}, time.Time{}); len(all) != 2 {
+		t.Fatalf("quarantined proof still listed")
+	}
+}
+
+func TestStore__Git(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fugl-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewGitStore(dir + "/canary")
+	if err != nil {
+		t.Fatalf("error creating git store, err=%v", err)
+	}
+	testStore(t, store)
+
+	// a commit per proof and timestamp, with a clean work tree
+	out, err := exec.Command("git", "-C", store.Dir, "log", "--oneline").Output()
+	if err != nil {
+		t.Fatalf("error reading git log, err=%v", err)
+	}
+	if commits := strings.Count(string(out), "\n"); commits != 4 {
+		t.Fatalf("expected 4 commits, got %d:\n%s", commits, out)
+	}
+	out, err = exec.Command("git", "-C", store.Dir, "status", "--porcelain").Output()
+	if err != nil || len(out) != 0 {
+		t.Fatalf("expected clean work tree, got %q (err=%v)", out, err)
+	}
+
+	// reopening reads the latest proof from the repository
+	reopened, err := NewGitStore(store.Dir)
+	if err != nil {
+		t.Fatalf("error reopening git store, err=%v", err)
+	}
+	if latest, _ := reopened.Latest(); latest == "" {
+		t.Fatal("latest proof not found after reopening")
+	}
+}
+
+func TestStore__GitRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fugl-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewGitStore(dir + "/canary")
+	if err != nil {
+		t.Fatalf("error creating git store, err=%v", err)
+	}
+	now := time.Now().Add(-time.Minute)
+	first := Canary{Creation: CanaryTime(now), Expiry: CanaryTime(now.Add(time.Hour))}
+	second := Canary{Creation: CanaryTime(now), Expiry: CanaryTime(now.Add(2 * time.Hour))}
+	if err := store.Save("first", &first); err != nil {
+		t.Fatalf("error saving proof, err=%v", err)
+	}
+	expectCommitted := func(store *GitStore) {
+		if latest, _ := store.Latest(); latest != "first" {
+			t.Fatalf("expected the committed latest proof, got %q", latest)
+		}
+		if count, _ := store.Count(); count != 1 {
+			t.Fatalf("expected 1 proof, got %d", count)
+		}
+		out, err := exec.Command("git", "-C", store.Dir, "status", "--porcelain").Output()
+		if err != nil || len(out) != 0 {
+			t.Fatalf("expected clean work tree, got %q (err=%v)", out, err)
+		}
+	}
+
+	// a failing commit (rejected ref update) restores the work tree
+	hook := store.Dir + "/.git/hooks/reference-transaction"
+	script := "#!/bin/sh\n[ \"$1\" = prepared ] && exit 1\nexit 0\n"
+	if err := ioutil.WriteFile(hook, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("second", &second); err == nil {
+		t.Fatal("expected commit to fail")
+	}
+	os.Remove(hook)
+	expectCommitted(store)
+
+	// uncommitted changes (e.g. a crash before committing) are discarded on open
+	if err := store.proofs.Save("second", &second); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(store.Dir+"/"+GitLatestFile, []byte("second"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewGitStore(store.Dir)
+	if err != nil {
+		t.Fatalf("error reopening git store, err=%v", err)
+	}
+	expectCommitted(reopened)
+}
+
+func TestStore__Open(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fugl-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if store, err := OpenStore(dir + "/proofs"); err != nil {
+		t.Fatalf("error opening directory store, err=%v", err)
+	} else if _, ok := store.(*DirectoryStore); !ok {
+		t.Fatal("expected a directory store by default")
+	}
+	if store, err := OpenStore("bolt:" + dir + "/proofs.db"); err != nil {
+		t.Fatalf("error opening bolt store, err=%v", err)
+	} else {
+		store.(*BoltStore).Close()
+	}
+	if store, err := OpenStore(dir + "/canary:prod"); err != nil {
+		t.Fatalf("error opening directory store with a colon, err=%v", err)
+	} else if store.(*DirectoryStore).Dir != dir+"/canary:prod" {
+		t.Fatalf("unexpected directory: %s", store.(*DirectoryStore).Dir)
+	}
+	for _, spec := range []string{"bolt:", "git:", ""} {
+		if _, err := OpenStore(spec); err == nil {
+			t.Fatalf("expected an error opening store %q", spec)
+		}
+	}
+}
+
+func TestStore__Migrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fugl-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src, _ := NewDirectoryStore(dir + "/proofs")
+	dst, err := NewBoltStore(dir + "/proofs.db")
+	if err != nil {
+		t.Fatalf("error creating bolt store, err=%v", err)
+	}
+	defer dst.Close()
+
+	// chain of proofs, rotating the key after the first
+	pubs, privs := newEd25519Keys(t, 2)
+	rotation := Ed25519KeyRotation(pubs[0], pubs[1])
+	now := time.Now()
+	var proofs []string
+	for i := 0; i < 3; i++ {
+		canary := Canary{
+			Version:  CanaryVersion,
+			Author:   "John Doe",
+			Creation: CanaryTime(now.Add(time.Duration(i) * time.Hour)),
+			Expiry:   CanaryTime(now.Add(time.Duration(i+1) * time.Hour)),
+			Nonce:    GetRandStr(CanaryNonceSize),
+		}
+		signer := Ed25519Signer{Keys: privs[1:]}
+		if i == 0 {
+			canary.Rotation = rotation
+			signer = Ed25519Signer{Keys: privs[:1]}
+		}
+		proof, err := SealProof(signer, canary, "")
+		if err != nil {
+			t.Fatalf("error sealing proof, err=%v", err)
+		}
+		src.Save(proof, &canary)
+		proofs = append(proofs, proof)
+	}
+	src.SaveTimestamp(HashString(proofs[1]), []byte("token"))
+
+	count, err := MigrateStore(dst, src, Ed25519Verifier{Keys: pubs[:1]})
+	if err != nil || count != 3 {
+		t.Fatalf("expected 3 proofs migrated, got %d (err=%v)", count, err)
+	}
+	if latest, _ := dst.Latest(); latest != proofs[2] {
+		t.Fatal("latest proof not migrated")
+	}
+	if token, _ := dst.Timestamp(HashString(proofs[1])); string(token) != "token" {
+		t.Fatal("timestamp not migrated")
+	}
+
+	// proofs must verify
+	other, _ := NewBoltStore(dir + "/other.db")
+	defer other.Close()
+	if _, err := MigrateStore(other, src, Ed25519Verifier{Keys: pubs[1:]}); err == nil {
+		t.Fatal("expected an error migrating proofs signed by an unknown key")
+	}
+}
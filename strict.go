@@ -0,0 +1,220 @@
+package fugl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/* Strict parsing of proofs.
+ * The signed body of a proof has a single canonical layout:
+ *
+ *   <description>    (optional, followed by one empty line)
+ *   # Metadata
+ *   <empty line>
+ *   <canary>         (serialized by SerializeCanary, nothing following)
+ *
+ * Any other layout is rejected,
+ * ensuring that verifiers can not disagree about the contents of a proof.
+ */
+
+type ProofParseError struct {
+	Line int    // line in the signed body (from 1), 0 if not applicable
+	Msg  string // description of the error
+}
+
+func (e *ProofParseError) Error() string {
+	if e.Line == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("Line %d: %s", e.Line, e.Msg)
+}
+
+func parseError(line int, format string, args ...interface{}) *ProofParseError {
+	return &ProofParseError{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func parseProofBodyStrict(body []byte) (*Canary, string, error) {
+	// find seperator, which must occur exactly once
+	sep := -1
+	lines := strings.Split(string(body), "\n")
+	for i, line := range lines {
+		if strings.ContainsRune(line, '\r') {
+			return nil, "", parseError(i+1, "Carriage return in proof")
+		}
+		if line == CANARY_SEPERATOR {
+			if sep != -1 {
+				return nil, "", parseError(i+1, "Repeated canary seperator (first on line %d)", sep+1)
+			}
+			sep = i
+		} else if strings.TrimSpace(line) == CANARY_SEPERATOR {
+			return nil, "", parseError(i+1, "Malformed canary seperator")
+		}
+	}
+	if sep == -1 {
+		return nil, "", parseError(0, "Unable to find canary seperator")
+	}
+
+	// description is followed by a single empty line
+	var description string
+	if sep > 0 {
+		if sep == 1 || lines[sep-1] != "" {
+			return nil, "", parseError(sep, "Description must be followed by an empty line")
+		}
+		if lines[sep-2] == "" {
+			return nil, "", parseError(sep-1, "Description must not end with empty lines")
+		}
+		description = strings.Join(lines[:sep-1], "\n")
+	}
+
+	// seperator is followed by a single empty line
+	if sep+2 >= len(lines) || lines[sep+1] != "" {
+		return nil, "", parseError(sep+2, "Canary seperator must be followed by an empty line")
+	}
+	if lines[sep+2] == "" {
+		return nil, "", parseError(sep+3, "Canary seperator must be followed by a single empty line")
+	}
+
+	// load JSON structure
+	first := sep + 3
+	canary, err := parseCanaryStrict([]byte(strings.Join(lines[sep+2:], "\n")), first)
+	if err != nil {
+		return nil, "", err
+	}
+	return canary, description, nil
+}
+
+/* the canary must be the canonical serialization:
+ * without duplicate keys, unknown keys or trailing data
+ */
+
+func parseCanaryStrict(data []byte, first int) (*Canary, error) {
+	keys, err := scanKeys(data, first)
+	if err != nil {
+		return nil, err
+	}
+	canary, err := parseCanary(data, true)
+	if err != nil {
+		return nil, jsonParseError(err, data, first, keys)
+	}
+	canonical, err := SerializeCanary(*canary)
+	if err != nil {
+		return nil, parseError(first, "Unable to serialize canary: %s", err.Error())
+	}
+	if !bytes.Equal(data, canonical) {
+		lines := strings.Split(string(data), "\n")
+		expected := strings.Split(string(canonical), "\n")
+		for i := range lines {
+			if i >= len(expected) || lines[i] != expected[i] {
+				return nil, parseError(first+i, "Canary not in canonical form, expected: %q", expectedLine(expected, i))
+			}
+		}
+		return nil, parseError(first+len(lines)-1, "Canary not in canonical form")
+	}
+	return canary, nil
+}
+
+func expectedLine(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return ""
+}
+
+// line of the byte offset in the JSON structure
+func lineAt(data []byte, offset int64, first int) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return first + bytes.Count(data[:offset], []byte("\n"))
+}
+
+func jsonParseError(err error, data []byte, first int, keys map[string]int) error {
+	line := 0
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		line = lineAt(data, e.Offset, first)
+	case *json.UnmarshalTypeError:
+		line = lineAt(data, e.Offset, first)
+	default:
+		// unknown fields are reported by name
+		if name, err := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field ")); err == nil {
+			line = keys[name]
+		}
+	}
+	return parseError(line, "Unable to parse canary: %s", err.Error())
+}
+
+/* scans the JSON structure, rejecting duplicate keys and trailing data.
+ * Returns the line of the first occurrence of every key.
+ */
+
+func scanKeys(data []byte, first int) (map[string]int, error) {
+	keys := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	err := scanValue(dec, data, first, keys)
+	if err != nil {
+		return nil, err
+	}
+	offset := dec.InputOffset()
+	if offset < int64(len(data)) {
+		return nil, parseError(lineAt(data, offset, first), "Trailing data after canary")
+	}
+	return keys, nil
+}
+
+func scanToken(dec *json.Decoder, data []byte, first int) (json.Token, error) {
+	tok, err := dec.Token()
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, parseError(lineAt(data, int64(len(data)), first), "Unexpected end of canary")
+	}
+	if err != nil {
+		return nil, jsonParseError(err, data, first, nil)
+	}
+	return tok, nil
+}
+
+func scanValue(dec *json.Decoder, data []byte, first int, keys map[string]int) error {
+	tok, err := scanToken(dec, data, first)
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		// keys are matched case-insensitively when decoding
+		seen := make(map[string]bool)
+		for dec.More() {
+			tok, err := scanToken(dec, data, first)
+			if err != nil {
+				return err
+			}
+			key := tok.(string)
+			line := lineAt(data, dec.InputOffset(), first)
+			if seen[strings.ToLower(key)] {
+				return parseError(line, "Duplicate key %q", key)
+			}
+			seen[strings.ToLower(key)] = true
+			if _, ok := keys[key]; !ok {
+				keys[key] = line
+			}
+			if err := scanValue(dec, data, first, keys); err != nil {
+				return err
+			}
+		}
+	case json.Delim('['):
+		for dec.More() {
+			if err := scanValue(dec, data, first, keys); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+
+	// closing delimiter
+	_, err = scanToken(dec, data, first)
+	return err
+}
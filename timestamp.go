@@ -0,0 +1,185 @@
+package fugl
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/digitorus/pkcs7"
+	"github.com/digitorus/timestamp"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/* RFC 3161 timestamps over proofs:
+ * a timestamp authority (TSA) signs the hash of the proof along with the time,
+ * giving independent evidence of when the proof existed.
+ *
+ * Tokens are stored alongside the proof (with the same file name and an additional extension).
+ */
+
+const (
+	TimestampFileExtension = ".tsr"
+	TimestampContentType   = "application/timestamp-query"
+	TimestampMaxSize       = 1 << 20
+	TimestampTolerance     = time.Second // canary creation times are rounded to seconds
+)
+
+/* Requests a timestamp over the proof from the TSA at url,
+ * returning the DER encoded timestamp token
+ */
+
+func RequestTimestamp(client *http.Client, url string, proof string) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return nil, err
+	}
+	req, err := timestamp.CreateRequest(strings.NewReader(proof), &timestamp.RequestOptions{
+		Hash:         crypto.SHA256,
+		Certificates: true,
+		Nonce:        nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Post(url, TimestampContentType, bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("Timestamp authority returned status: %d", resp.StatusCode))
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, TimestampMaxSize))
+	if err != nil {
+		return nil, err
+	}
+	ts, err := timestamp.ParseResponse(body)
+	if err != nil {
+		return nil, errors.New("Invalid timestamp response: " + err.Error())
+	}
+	if ts.Nonce == nil || ts.Nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("Timestamp response does not match request nonce")
+	}
+	if err := checkTimestampHash(ts, proof); err != nil {
+		return nil, err
+	}
+	return ts.RawToken, nil
+}
+
+/* Loads a bundle of PEM encoded TSA (root) certificates
+ */
+
+func LoadTimestampCertificates(bundle []byte) (*x509.CertPool, error) {
+	roots := x509.NewCertPool()
+	found := false
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		roots.AddCert(cert)
+		found = true
+	}
+	if !found {
+		return nil, errors.New("No certificates found in bundle")
+	}
+	return roots, nil
+}
+
+func checkTimestampHash(ts *timestamp.Timestamp, proof string) error {
+	switch ts.HashAlgorithm {
+	case crypto.SHA256, crypto.SHA384, crypto.SHA512:
+	default:
+		return errors.New("Unsupported timestamp hash algorithm")
+	}
+	hash := ts.HashAlgorithm.New()
+	hash.Write([]byte(proof))
+	if !bytes.Equal(hash.Sum(nil), ts.HashedMessage) {
+		return errors.New("Timestamp does not cover proof")
+	}
+	return nil
+}
+
+/* Verifies the timestamp token over the proof,
+ * the TSA certificate must chain to one of the roots and be valid for time stamping.
+ *
+ * Returns the time attested by the TSA.
+ */
+
+func VerifyTimestamp(roots *x509.CertPool, proof string, token []byte) (time.Time, error) {
+	ts, err := timestamp.Parse(token)
+	if err != nil {
+		return time.Time{}, errors.New("Invalid timestamp token: " + err.Error())
+	}
+	if err := checkTimestampHash(ts, proof); err != nil {
+		return time.Time{}, err
+	}
+
+	// verify signature and chain of TSA certificate (at the time attested)
+	p7, err := pkcs7.Parse(token)
+	if err != nil {
+		return time.Time{}, errors.New("Invalid timestamp token: " + err.Error())
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range p7.Certificates {
+		intermediates.AddCert(cert)
+	}
+	err = p7.VerifyWithOpts(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   ts.Time,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return time.Time{}, errors.New("Invalid timestamp signature: " + err.Error())
+	}
+	return ts.Time, nil
+}
+
+/* Verifies the proof along with a timestamp token over it,
+ * the canary can not have been created after the time attested by the TSA
+ */
+
+func VerifyTimestampedProof(verifier Verifier, roots *x509.CertPool, proof string, token []byte) (*Proof, error) {
+	opened, err := VerifyProof(verifier, proof)
+	if err != nil {
+		return nil, err
+	}
+	err = CheckProofTimestamp(opened, roots, proof, token)
+	if err != nil {
+		return nil, err
+	}
+	return opened, nil
+}
+
+/* Checks the timestamp token over an opened proof,
+ * setting the timestamp of the proof if valid
+ */
+
+func CheckProofTimestamp(opened *Proof, roots *x509.CertPool, proof string, token []byte) error {
+	when, err := VerifyTimestamp(roots, proof, token)
+	if err != nil {
+		return err
+	}
+	if when.Add(TimestampTolerance).Before(opened.Canary.Creation.Time()) {
+		return errors.New("Timestamp predates creation of canary")
+	}
+	opened.Timestamp = &when
+	return nil
+}
@@ -0,0 +1,179 @@
+package fugl
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"github.com/digitorus/timestamp"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+/* in-process timestamp authority,
+ * returns the server and a PEM bundle containing its root certificate
+ */
+
+func newTSA(t *testing.T, now func() time.Time) (*httptest.Server, []byte) {
+	rootKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test TSA Root"},
+		NotBefore:             time.Now().Add(-24 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatalf("error creating root certificate, err=%v", err)
+	}
+	root, _ := x509.ParseCertificate(rootDER)
+
+	tsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tsaTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test TSA"},
+		NotBefore:    time.Now().Add(-24 * time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	tsaDER, err := x509.CreateCertificate(rand.Reader, tsaTemplate, root, &tsaKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatalf("error creating tsa certificate, err=%v", err)
+	}
+	tsaCert, _ := x509.ParseCertificate(tsaDER)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req, err := timestamp.ParseRequest(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ts := timestamp.Timestamp{
+			HashAlgorithm:     req.HashAlgorithm,
+			HashedMessage:     req.HashedMessage,
+			Time:              now(),
+			Nonce:             req.Nonce,
+			Policy:            asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1},
+			AddTSACertificate: req.Certificates,
+		}
+		resp, err := ts.CreateResponseWithOpts(tsaCert, tsaKey, crypto.SHA256)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		w.Write(resp)
+	}))
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER})
+	return server, bundle
+}
+
+func TestTimestamp__RequestAndVerify(t *testing.T) {
+	server, bundle := newTSA(t, time.Now)
+	defer server.Close()
+	roots, err := LoadTimestampCertificates(bundle)
+	if err != nil {
+		t.Fatalf("error loading tsa certificates, err=%v", err)
+	}
+
+	edPubs, edPrivs := newEd25519Keys(t, 1)
+	canary := Canary{
+		Version:  CanaryVersion,
+		Author:   "John Doe",
+		Creation: CanaryTime(time.Now()),
+		Expiry:   CanaryTime(time.Now().Add(time.Hour)),
+		Nonce:    GetRandStr(CanaryNonceSize),
+	}
+	proof, err := SealProof(Ed25519Signer{Keys: edPrivs}, canary, "")
+	if err != nil {
+		t.Fatalf("error sealing proof, err=%v", err)
+	}
+
+	token, err := RequestTimestamp(server.Client(), server.URL, proof)
+	if err != nil {
+		t.Fatalf("error requesting timestamp, err=%v", err)
+	}
+	opened, err := VerifyTimestampedProof(Ed25519Verifier{Keys: edPubs}, roots, proof, token)
+	if err != nil {
+		t.Fatalf("error verifying timestamped proof, err=%v", err)
+	}
+	if opened.Timestamp == nil || time.Since(*opened.Timestamp) > time.Minute {
+		t.Fatalf("unexpected timestamp: %v", opened.Timestamp)
+	}
+
+	// token only covers the proof it was issued for
+	other, _ := SealProof(Ed25519Signer{Keys: edPrivs}, canary, "other description")
+	if _, err := VerifyTimestamp(roots, other, token); err == nil {
+		t.Fatal("expected an error verifying timestamp over a different proof")
+	}
+
+	// token must chain to a trusted root
+	otherServer, otherBundle := newTSA(t, time.Now)
+	defer otherServer.Close()
+	otherRoots, _ := LoadTimestampCertificates(otherBundle)
+	if _, err := VerifyTimestamp(otherRoots, proof, token); err == nil {
+		t.Fatal("expected an error verifying timestamp from an untrusted authority")
+	}
+
+	// stored alongside the proof, ignored when listing proofs
+	dir, err := ioutil.TempDir("", "fugl-timestamp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := &DirectoryStore{Dir: dir}
+	if err := store.Save(proof, &canary); err != nil {
+		t.Fatalf("error saving proof, err=%v", err)
+	}
+	if err := store.SaveTimestamp(HashString(proof), token); err != nil {
+		t.Fatalf("error saving timestamp, err=%v", err)
+	}
+	proofs, err := store.List(time.Time{}, time.Time{})
+	if err != nil || len(proofs) != 1 {
+		t.Fatalf("expected a single proof in store, got %d (err=%v)", len(proofs), err)
+	}
+	loaded, err := store.Timestamp(HashString(proof))
+	if err != nil || string(loaded) != string(token) {
+		t.Fatalf("error loading timestamp, err=%v", err)
+	}
+}
+
+func TestTimestamp__PredatesCreation(t *testing.T) {
+	past := func() time.Time {
+		return time.Now().Add(-time.Hour)
+	}
+	server, bundle := newTSA(t, past)
+	defer server.Close()
+	roots, _ := LoadTimestampCertificates(bundle)
+
+	edPubs, edPrivs := newEd25519Keys(t, 1)
+	canary := Canary{
+		Version:  CanaryVersion,
+		Author:   "John Doe",
+		Creation: CanaryTime(time.Now()),
+		Expiry:   CanaryTime(time.Now().Add(time.Hour)),
+		Nonce:    GetRandStr(CanaryNonceSize),
+	}
+	proof, _ := SealProof(Ed25519Signer{Keys: edPrivs}, canary, "")
+	token, err := RequestTimestamp(server.Client(), server.URL, proof)
+	if err != nil {
+		t.Fatalf("error requesting timestamp, err=%v", err)
+	}
+	if _, err := VerifyTimestampedProof(Ed25519Verifier{Keys: edPubs}, roots, proof, token); err == nil {
+		t.Fatal("expected an error when timestamp predates creation of canary")
+	}
+}
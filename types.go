@@ -10,13 +10,16 @@ import (
 type CanaryTime time.Time
 
 type Canary struct {
-	Version  int64      `json:"version"`  // Canary struct version
-	Author   string     `json:"author"`   // Publishing entity of the canary
-	Creation CanaryTime `json:"creation"` // Time of creation
-	Expiry   CanaryTime `json:"expiry"`   // Expiry time of canary
-	Promises []string   `json:"promises"` // Set of promises (may be empty)
-	Nonce    string     `json:"nonce"`    // Random nonce
-	Final    bool       `json:"final"`    // Is this canary final?
+	Version   int64             `json:"version"`             // Canary struct version
+	Author    string            `json:"author"`              // Publishing entity of the canary
+	Creation  CanaryTime        `json:"creation"`            // Time of creation
+	Expiry    CanaryTime        `json:"expiry"`              // Expiry time of canary
+	Promises  []Promise         `json:"promises"`            // Set of promises (may be empty)
+	Nonce     string            `json:"nonce"`               // Random nonce
+	Final     bool              `json:"final"`               // Is this canary final?
+	Previous  string            `json:"previous"`            // Hash of the proof superseded (empty if first)
+	Rotation  *KeyRotation      `json:"rotation,omitempty"`  // Announced key rotation (optional)
+	Freshness []FreshnessAnchor `json:"freshness,omitempty"` // Externally observed values (optional)
 }
 
 func (c Canary) Equal(other Canary) bool {
@@ -24,9 +27,92 @@ func (c Canary) Equal(other Canary) bool {
 		(c.Author == other.Author) &&
 		c.Creation.Time().Equal(other.Creation.Time()) &&
 		c.Expiry.Time().Equal(other.Expiry.Time()) &&
-		reflect.DeepEqual(c.Promises, other.Promises) &&
+		promisesEqual(c.Promises, other.Promises) &&
 		(c.Nonce == other.Nonce) &&
-		(c.Final == other.Final)
+		(c.Final == other.Final) &&
+		(c.Previous == other.Previous) &&
+		reflect.DeepEqual(c.Rotation, other.Rotation) &&
+		freshnessEqual(c.Freshness, other.Freshness)
+}
+
+/* promises are matched across canaries by their identifier,
+ * allowing the text to be reworded without the promise being removed
+ */
+
+type Promise struct {
+	ID       string      `json:"id"`                 // Stable identifier
+	Text     string      `json:"text"`               // Statement (for humans)
+	Category string      `json:"category,omitempty"` // Optional category
+	Since    *CanaryTime `json:"since,omitempty"`    // Optional time the promise was first made
+}
+
+func (p Promise) Equal(other Promise) bool {
+	if (p.Since == nil) != (other.Since == nil) {
+		return false
+	}
+	if p.Since != nil && !p.Since.Time().Equal(other.Since.Time()) {
+		return false
+	}
+	return (p.ID == other.ID) &&
+		(p.Text == other.Text) &&
+		(p.Category == other.Category)
+}
+
+func promisesEqual(a []Promise, b []Promise) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+/* pairs promises with the same identifier,
+ * Old is nil for added promises and New is nil for removed promises
+ */
+
+type PromiseMatch struct {
+	Old *Promise
+	New *Promise
+}
+
+func (c Canary) Promise(id string) (Promise, bool) {
+	for _, promise := range c.Promises {
+		if promise.ID == id {
+			return promise, true
+		}
+	}
+	return Promise{}, false
+}
+
+func MatchPromises(old []Promise, new []Promise) []PromiseMatch {
+	var matches []PromiseMatch
+	for i := range old {
+		match := PromiseMatch{Old: &old[i]}
+		for j := range new {
+			if new[j].ID == old[i].ID {
+				match.New = &new[j]
+				break
+			}
+		}
+		matches = append(matches, match)
+	}
+	for j := range new {
+		found := false
+		for i := range old {
+			if old[i].ID == new[j].ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			matches = append(matches, PromiseMatch{New: &new[j]})
+		}
+	}
+	return matches
 }
 
 /* specifies the time format used in the canaries
@@ -13,7 +13,7 @@ func TestCanarySerializeCycle(t *testing.T) {
 		Author: "John Doe",
 		Creation: CanaryTime(time.Now()),
 		Expiry: CanaryTime(time.Now()),
-		Promises: []string{"example"},
+		Promises: []Promise{{ID: "example", Text: "example"}},
 		Nonce: "nonce",
 		Final: false,
 	}
@@ -36,3 +36,35 @@ func TestCanarySerializeCycle(t *testing.T) {
 		t.Fatal("serialization cycle mismatch")
 	}
 }
+
+func TestCanaryMatchPromises(t *testing.T) {
+	old := []Promise{
+		{ID: "kept", Text: "kept"},
+		{ID: "reworded", Text: "original"},
+		{ID: "removed", Text: "removed"},
+	}
+	new := []Promise{
+		{ID: "reworded", Text: "reworded"},
+		{ID: "kept", Text: "kept"},
+		{ID: "added", Text: "added"},
+	}
+
+	matches := MatchPromises(old, new)
+	if len(matches) != 4 {
+		t.Fatalf("expected 4 matches, got %d", len(matches))
+	}
+	for _, match := range matches {
+		switch {
+		case match.Old == nil:
+			if match.New.ID != "added" {
+				t.Fatalf("unexpected added promise: %s", match.New.ID)
+			}
+		case match.New == nil:
+			if match.Old.ID != "removed" {
+				t.Fatalf("unexpected removed promise: %s", match.Old.ID)
+			}
+		case match.Old.ID != match.New.ID:
+			t.Fatalf("matched promises with different ids: %s, %s", match.Old.ID, match.New.ID)
+		}
+	}
+}
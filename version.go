@@ -0,0 +1,138 @@
+package fugl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+/* Canaries are serialized according to their version field,
+ * the Canary structure is the normalized (latest) form
+ * and older versions are converted to and from it.
+ *
+ * New fields are only added to the latest version.
+ */
+
+// version 0: the original canary format
+type canaryV0 struct {
+	Version  int64      `json:"version"`
+	Author   string     `json:"author"`
+	Creation CanaryTime `json:"creation"`
+	Expiry   CanaryTime `json:"expiry"`
+	Promises []string   `json:"promises"`
+	Nonce    string     `json:"nonce"`
+	Final    bool       `json:"final"`
+	Previous string     `json:"previous"`
+}
+
+/* promises in version 0 are bare strings,
+ * the text of the promise doubles as its identifier
+ */
+
+func (c canaryV0) normalize() *Canary {
+	var promises []Promise
+	for _, text := range c.Promises {
+		promises = append(promises, Promise{ID: text, Text: text})
+	}
+	return &Canary{
+		Version:  c.Version,
+		Author:   c.Author,
+		Creation: c.Creation,
+		Expiry:   c.Expiry,
+		Promises: promises,
+		Nonce:    c.Nonce,
+		Final:    c.Final,
+		Previous: c.Previous,
+	}
+}
+
+func canaryToV0(c Canary) (canaryV0, error) {
+	if c.Rotation != nil {
+		return canaryV0{}, errors.New("Key rotation requires canary version 1")
+	}
+	if len(c.Freshness) != 0 {
+		return canaryV0{}, errors.New("Freshness anchors require canary version 1")
+	}
+	var promises []string
+	for _, promise := range c.Promises {
+		if promise.ID != promise.Text || promise.Category != "" || promise.Since != nil {
+			return canaryV0{}, errors.New("Structured promises require canary version 1")
+		}
+		promises = append(promises, promise.Text)
+	}
+	return canaryV0{
+		Version:  c.Version,
+		Author:   c.Author,
+		Creation: c.Creation,
+		Expiry:   c.Expiry,
+		Promises: promises,
+		Nonce:    c.Nonce,
+		Final:    c.Final,
+		Previous: c.Previous,
+	}, nil
+}
+
+func CanaryVersionSupported(version int64) bool {
+	return version >= CanaryVersionMin && version <= CanaryVersion
+}
+
+func ParseCanary(data []byte) (*Canary, error) {
+	return parseCanary(data, false)
+}
+
+// strict decoding rejects unknown fields
+func decodeCanary(data []byte, v interface{}, strict bool) error {
+	if !strict {
+		return json.Unmarshal(data, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func parseCanary(data []byte, strict bool) (*Canary, error) {
+	// read version field
+	var header struct {
+		Version *int64 `json:"version"`
+	}
+	err := json.Unmarshal(data, &header)
+	if err != nil {
+		return nil, err
+	}
+	if header.Version == nil {
+		return nil, errors.New("Canary has no version field")
+	}
+
+	// parse the versioned structure
+	switch *header.Version {
+	case 0:
+		var canary canaryV0
+		err = decodeCanary(data, &canary, strict)
+		if err != nil {
+			return nil, err
+		}
+		return canary.normalize(), nil
+	case 1:
+		var canary Canary
+		err = decodeCanary(data, &canary, strict)
+		if err != nil {
+			return nil, err
+		}
+		return &canary, nil
+	}
+	return nil, errors.New("Unsupported canary version")
+}
+
+func SerializeCanary(canary Canary) ([]byte, error) {
+	switch canary.Version {
+	case 0:
+		old, err := canaryToV0(canary)
+		if err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(old, "", "    ")
+	case 1:
+		return json.MarshalIndent(canary, "", "    ")
+	}
+	return nil, errors.New("Unsupported canary version")
+}
@@ -0,0 +1,90 @@
+package fugl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVersion__SerializeCycle(t *testing.T) {
+	for _, version := range []int64{0, 1} {
+		canary := Canary{
+			Version:  version,
+			Author:   "John Doe",
+			Creation: CanaryTime(time.Now()),
+			Expiry:   CanaryTime(time.Now()),
+			Promises: []Promise{{ID: "example", Text: "example"}},
+			Nonce:    "nonce",
+			Previous: "previous",
+		}
+
+		ser, err := SerializeCanary(canary)
+		if err != nil {
+			t.Fatalf("error serializing version %d canary, err=%v", version, err)
+		}
+		out, err := ParseCanary(ser)
+		if err != nil {
+			t.Fatalf("error parsing version %d canary, err=%v", version, err)
+		}
+		if !canary.Equal(*out) {
+			t.Fatalf("serialization cycle mismatch for version %d", version)
+		}
+	}
+}
+
+func TestVersion__ParseUnsupported(t *testing.T) {
+	cases := []string{
+		`{"author": "John Doe"}`,
+		`{"version": 2, "author": "John Doe"}`,
+		`{"version": -1, "author": "John Doe"}`,
+		`not json`,
+	}
+	for _, data := range cases {
+		canary, err := ParseCanary([]byte(data))
+		if err == nil {
+			t.Fatalf("expected an error parsing '%s'", data)
+		}
+		if canary != nil {
+			t.Fatalf("should not get a canary parsing '%s'", data)
+		}
+	}
+
+	_, err := SerializeCanary(Canary{Version: 2})
+	if err == nil {
+		t.Fatal("expected an error serializing unsupported version")
+	}
+}
+
+func TestVersion__StructuredPromises(t *testing.T) {
+	since := CanaryTime(time.Now())
+	canary := Canary{
+		Version:  0,
+		Promises: []Promise{{ID: "id", Text: "text", Since: &since}},
+	}
+	_, err := SerializeCanary(canary)
+	if err == nil {
+		t.Fatal("expected an error serializing structured promises as version 0")
+	}
+
+	old, err := ParseCanary([]byte(`{"version": 0, "promises": ["example"]}`))
+	if err != nil {
+		t.Fatalf("error parsing version 0 canary, err=%v", err)
+	}
+	promise, ok := old.Promise("example")
+	if !ok || promise.Text != "example" {
+		t.Fatal("version 0 promise not identified by its text")
+	}
+
+	// empty and repeated version 0 promises remain valid
+	now := time.Now()
+	old = &Canary{
+		Version:  0,
+		Author:   "John Doe",
+		Creation: CanaryTime(now.Add(-time.Minute)),
+		Expiry:   CanaryTime(now.Add(time.Hour)),
+		Nonce:    GetRandStr(CanaryNonceSize),
+		Promises: []Promise{{ID: "", Text: ""}, {ID: "example", Text: "example"}, {ID: "example", Text: "example"}},
+	}
+	if err := CheckCanaryFormat(old, now); err != nil {
+		t.Fatalf("error checking version 0 promises, err=%v", err)
+	}
+}